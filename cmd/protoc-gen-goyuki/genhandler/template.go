@@ -422,13 +422,13 @@ var (
 	{{ range $m := $svc.Methods }}
 	{{ range $b := $m.Bindings }}
 
-	unmarshaler_goyuki_{{ $svc.GetName | goTypeName }}_{{ $m.GetName }}_{{ $b.Index }} = func(r *{{ pkg "http" }}Request) func(interface{})(error) {
+	unmarshaler_goyuki_{{ $svc.GetName | goTypeName }}_{{ $m.GetName }}_{{ $b.Index }} = func(r *{{ pkg "http" }}Request, inbound {{ pkg "httpruntime" }}Marshaler) func(interface{})(error) {
 		return func(rif interface{}) error {
 			req := rif.(*{{$m.RequestType.GoType $m.Service.File.GoPkg.Path | goTypeName }})
 
 			{{ if not (hasAsterisk $b.ExplicitParams) }}
-			if err := {{ pkg "errors" }}Wrap({{ pkg "runtime" }}PopulateQueryParameters(req, r.URL.Query(), unmarshaler_goyuki_{{ $svc.GetName | goTypeName }}_{{ $m.GetName }}_{{ $b.Index }}_boundParams),"couldn't populate query parameters"); err != nil {
-				return {{ pkg "httpruntime" }}TransformUnmarshalerError(err)
+			if err := {{ pkg "httptransport" }}PopulateQueryParameters(req, r.URL.Query(), unmarshaler_goyuki_{{ $svc.GetName | goTypeName }}_{{ $m.GetName }}_{{ $b.Index }}_boundParams); err != nil {
+				return err
 			}
 			{{ end }}
 			{{- if $b.Body -}}
@@ -436,9 +436,8 @@ var (
 			{{ $t }}
 			{{- end }}
 
-			inbound,_ := {{ pkg "httpruntime" }}MarshalerForRequest(r)
-			if err := {{ pkg "errors" }}Wrap(inbound.Unmarshal(r.Body,&{{.Body.AssignableExpr "req"}}),"couldn't read request JSON"); err != nil {
-				return {{ pkg "httptransport" }}NewMarshalerError({{ pkg "httpruntime" }}TransformUnmarshalerError(err))
+			if err := {{ pkg "errors" }}Wrap(inbound.Unmarshal(r.Body,&{{.Body.AssignableExpr "req"}}),"couldn't read request body"); err != nil {
+				return {{ pkg "httptransport" }}NewFieldError({{ pkg "httpruntime" }}TransformUnmarshalerError(err), {{ pkg "httptransport" }}LocationBody, "{{ $b.Body.FieldPath.String }}")
 			}
 			{{- end -}}
 			{{- if $b.PathParams -}}
@@ -461,7 +460,7 @@ if rctx == nil {
 }
 for pos,k := range rctx.URLParams.Keys {
 	if err := {{ pkg "errors" }}Wrapf({{ pkg "runtime" }}PopulateFieldFromPath(req, k, rctx.URLParams.Values[pos]), "can't read '%v' from path",k); err != nil {
-		return {{ pkg "httptransport" }}NewMarshalerError({{ pkg "httpruntime" }}TransformUnmarshalerError(err))
+		return {{ pkg "httptransport" }}NewFieldError({{ pkg "httpruntime" }}TransformUnmarshalerError(err), {{ pkg "httptransport" }}LocationPath, k)
 	}
 }
 {{ end }}
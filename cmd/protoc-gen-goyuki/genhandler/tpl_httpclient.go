@@ -8,15 +8,16 @@ var clientTemplate = template.Must(template.New("http-client").Funcs(funcMap).Op
 type {{ $svc.GetName | goTypeName }}_httpClient struct {
     c *{{ pkg "http" }}Client
     host string
+    opts {{ pkg "httpclient" }}Options
 }
 
 // New{{ $svc.GetName | goTypeName }}HTTPClient creates new HTTP client for {{ $svc.GetName | goTypeName }}Server.
 // Pass addr in format "http://host[:port]".
-func New{{ $svc.GetName | goTypeName }}HTTPClient(c *{{ pkg "http" }}Client,addr string) *{{ $svc.GetName | goTypeName }}_httpClient {
+func New{{ $svc.GetName | goTypeName }}HTTPClient(c *{{ pkg "http" }}Client,addr string,opts ...{{ pkg "httpclient" }}Option) *{{ $svc.GetName | goTypeName }}_httpClient {
     if {{ pkg "strings" }}HasSuffix(addr, "/") {
         addr = addr[:len(addr)-1]
     }
-    return &{{ $svc.GetName | goTypeName }}_httpClient{c:c,host:addr}
+    return &{{ $svc.GetName | goTypeName }}_httpClient{c:c,host:addr,opts:{{ pkg "httpclient" }}NewOptions(opts...)}
 }
 {{ end }}
 
@@ -33,7 +34,7 @@ func (c *{{ $svc.GetName | goTypeName }}_httpClient) {{ $m.GetName | goTypeName
 
     buf := {{ pkg "bytes" }}NewBuffer(nil)
 
-    m := {{ pkg "httpruntime" }}DefaultMarshaler(nil)
+    m := c.opts.Marshaler()
     {{ if $b.Body }}
     if err = m.Marshal(buf, {{.Body.AssignableExpr "in"}}); err != nil {
 	return nil, {{ pkg "errors" }}Wrap(err, "can't marshal request")
@@ -46,6 +47,9 @@ func (c *{{ $svc.GetName | goTypeName }}_httpClient) {{ $m.GetName | goTypeName
         return nil, {{ pkg "errors" }}Wrap(err, "can't initiate HTTP request")
     }
     req = req.WithContext(ctx)
+    {{ if $b.Body -}}
+    req.Header.Set("Content-Type", m.ContentType())
+    {{ end -}}
 
     req.Header.Add("Accept", m.ContentType())
 
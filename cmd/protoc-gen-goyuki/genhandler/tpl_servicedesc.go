@@ -69,15 +69,34 @@ func (d *{{ $svc.GetName | goTypeName }}Desc) RegisterHTTP(mux {{ pkg "transport
 		h = {{ pkg "http" }}HandlerFunc(func(w {{ pkg "http" }}ResponseWriter, r *{{ pkg "http" }}Request) {
 			defer r.Body.Close()
 
-			unmFunc := unmarshaler_goyuki_{{ $svc.GetName | goTypeName }}_{{ $m.GetName }}_{{ $b.Index }}(r)
+			r = r.WithContext({{ pkg "httptransport" }}NewBindingContext(r.Context(), {{ pkg "httptransport" }}Binding{
+				Method:  "{{ $b.HTTPMethod }}",
+				Pattern: pattern_goyuki_{{ $svc.GetName | goTypeName }}_{{ $m.GetName }}_{{ $b.Index }},
+			}))
+
+			w.Header().Add("Vary", "Accept")
+			outbound, err := d.opts.MarshalerRegistry().Outbound(r)
+			if err != nil {
+				d.opts.SetError(r.Context(),r,w,err)
+				return
+			}
+			var inbound {{ pkg "httpruntime" }}Marshaler
+			{{ if hasBody $b -}}
+			if inbound, err = d.opts.MarshalerRegistry().Inbound(r); err != nil {
+				d.opts.SetError(r.Context(),r,w,err)
+				return
+			}
+			{{ end -}}
+
+			unmFunc := unmarshaler_goyuki_{{ $svc.GetName | goTypeName }}_{{ $m.GetName }}_{{ $b.Index }}(r, d.opts.UnknownFieldsMarshaler(r.Context(), inbound))
+			{{ if not (hasAsterisk $b.ExplicitParams) -}}
+			unmFunc = d.opts.CheckUnknownQuery(r, unmFunc, unmarshaler_goyuki_{{ $svc.GetName | goTypeName }}_{{ $m.GetName }}_{{ $b.Index }}_boundParams)
+			{{ end -}}
 			rsp,err := _{{ $svc.GetName | goTypeName }}_{{ $m.GetName | goTypeName }}_Handler(d.svc,r.Context(),unmFunc,d.opts.UnaryInterceptor)
 
 			if err != nil {
-				if err,ok := err.({{ pkg "httptransport" }}MarshalerError); ok {
-					{{ pkg "httpruntime" }}SetError(r.Context(),r,w,{{ pkg "errors" }}Wrap(err.Err,"couldn't parse request"))
-					return
-				}
-				{{ pkg "httpruntime" }}SetError(r.Context(),r,w,err)
+				// MarshalerError is reported as InvalidArgument
+				d.opts.SetError(r.Context(),r,w,err)
 				return
 			}
 
@@ -86,7 +105,6 @@ func (d *{{ $svc.GetName | goTypeName }}Desc) RegisterHTTP(mux {{ pkg "transport
 				return
 			}
 
-			_,outbound := {{ pkg "httpruntime" }}MarshalerForRequest(r)
 			w.Header().Set("Content-Type", outbound.ContentType())
 			{{ if $b | ResponseBody -}}
 			xrsp := rsp.(*{{$m.ResponseType.GoType $m.Service.File.GoPkg.Path | goTypeName }})
@@ -95,7 +113,7 @@ func (d *{{ $svc.GetName | goTypeName }}Desc) RegisterHTTP(mux {{ pkg "transport
 			err = outbound.Marshal(w, rsp)
 			{{ end -}}
 			if err != nil {
-				{{ pkg "httpruntime" }}SetError(r.Context(),r,w,{{ pkg "errors" }}Wrap(err,"couldn't write response"))
+				d.opts.SetError(r.Context(),r,w,{{ pkg "errors" }}Wrap(err,"couldn't write response"))
 				return
 			}
 		})
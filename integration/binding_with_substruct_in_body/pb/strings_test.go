@@ -9,6 +9,8 @@ import (
 
 	"github.com/go-chi/chi"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/ra9form/yuki/transport/httpruntime"
 )
 
 func TestBindingSubstruct(t *testing.T) {
@@ -24,7 +26,7 @@ func TestBindingSubstruct(t *testing.T) {
 
 	got := String{}
 
-	f := unmarshaler_goyuki_Strings_ToUpper_0(req)
+	f := unmarshaler_goyuki_Strings_ToUpper_0(req, httpruntime.DefaultMarshaler(nil))
 	err = f(&got)
 	so.Nil(err)
 	so.Equal(int32(123), got.Substruct.Id)
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	"sort"
+
+	"github.com/go-chi/chi"
+
+	"github.com/ra9form/yuki/transport"
+)
+
+// newAdminHandler creates the handler for the operational endpoints
+// served on the admin port.
+func (s *Server) newAdminHandler(desc transport.ServiceDesc, public chi.Routes) http.Handler {
+	mux := chi.NewMux()
+
+	mux.Get("/healthz", s.serveHealth)
+	mux.Get("/readyz", s.serveReady)
+
+	mux.Get("/swagger.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.Copy(w, bytes.NewReader(desc.SwaggerDef()))
+	})
+	mux.Get("/version", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, newVersionInfo())
+	})
+	mux.Get("/routes", func(w http.ResponseWriter, r *http.Request) {
+		routes, err := listRoutes(public)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, routes)
+	})
+
+	if s.opts.Metrics != nil {
+		mux.Handle("/metrics", s.opts.Metrics.Handler())
+	}
+
+	mux.HandleFunc("/debug/pprof/*", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	return mux
+}
+
+// serveReady reports whether the server is ready, see isReady.
+func (s *Server) serveReady(w http.ResponseWriter, r *http.Request) {
+	if !s.isReady() {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte("ok"))
+}
+
+// isReady returns true if the server is serving requests and
+// is not shutting down.
+func (s *Server) isReady() bool {
+	select {
+	case <-s.ready:
+		return !s.isStopping()
+	default:
+		return false
+	}
+}
+
+type versionInfo struct {
+	GoVersion string            `json:"go_version"`
+	Path      string            `json:"path,omitempty"`
+	Version   string            `json:"version,omitempty"`
+	Settings  map[string]string `json:"settings,omitempty"`
+}
+
+// newVersionInfo returns the build info embedded in the binary.
+func newVersionInfo() versionInfo {
+	ret := versionInfo{GoVersion: runtime.Version()}
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ret
+	}
+	ret.Path = bi.Main.Path
+	ret.Version = bi.Main.Version
+	if len(bi.Settings) > 0 {
+		ret.Settings = make(map[string]string, len(bi.Settings))
+		for _, s := range bi.Settings {
+			ret.Settings[s.Key] = s.Value
+		}
+	}
+	return ret
+}
+
+type routeInfo struct {
+	Method  string `json:"method"`
+	Pattern string `json:"pattern"`
+}
+
+// listRoutes returns every route registered at the router.
+func listRoutes(r chi.Routes) ([]routeInfo, error) {
+	var ret []routeInfo
+	err := chi.Walk(r, func(method string, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		ret = append(ret, routeInfo{Method: method, Pattern: route})
+		return nil
+	})
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Pattern != ret[j].Pattern {
+			return ret[i].Pattern < ret[j].Pattern
+		}
+		return ret[i].Method < ret[j].Method
+	})
+	return ret, err
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
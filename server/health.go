@@ -0,0 +1,91 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Health returns the health service of the server.
+// It reports SERVING for every registered gRPC service once the server
+// starts and NOT_SERVING for all of them once the shutdown starts.
+// Use it to report the status of the service's dependencies.
+// The service must not register a health service of its own, Run fails
+// otherwise.
+func (s *Server) Health() *health.Server {
+	return s.health
+}
+
+// registerHealth registers the health service and marks the services
+// registered by the service as SERVING.
+// It fails if the service has registered the health service already,
+// since Health wouldn't report the status served then.
+func (s *Server) registerHealth(srv *grpc.Server) error {
+	info := srv.GetServiceInfo()
+	if _, ok := info[healthpb.Health_ServiceDesc.ServiceName]; ok {
+		return errors.New("health service is registered by the service, use Server.Health instead")
+	}
+	healthpb.RegisterHealthServer(srv, s.health)
+
+	s.healthServices = s.healthServices[:0]
+	for name := range info {
+		if name == healthpb.Health_ServiceDesc.ServiceName {
+			continue
+		}
+		s.healthServices = append(s.healthServices, name)
+		s.health.SetServingStatus(name, healthpb.HealthCheckResponse_SERVING)
+	}
+	sort.Strings(s.healthServices)
+	return nil
+}
+
+type healthInfo struct {
+	Status   string            `json:"status"`
+	Services map[string]string `json:"services,omitempty"`
+}
+
+// serveHealth reports the overall status and the status of every
+// registered service.
+// The status of a single service is reported if the service query
+// parameter is set.
+// It responds with 503 unless the status is SERVING.
+func (s *Server) serveHealth(w http.ResponseWriter, r *http.Request) {
+	check := func(name string) healthpb.HealthCheckResponse_ServingStatus {
+		rsp, err := s.health.Check(r.Context(), &healthpb.HealthCheckRequest{Service: name})
+		if err != nil {
+			return healthpb.HealthCheckResponse_SERVICE_UNKNOWN
+		}
+		return rsp.Status
+	}
+
+	var info healthInfo
+	var status healthpb.HealthCheckResponse_ServingStatus
+	if name, ok := r.URL.Query()["service"]; ok {
+		status = check(name[0])
+	} else {
+		status = check("")
+		info.Services = make(map[string]string, len(s.healthServices))
+		for _, name := range s.healthServices {
+			st := check(name)
+			info.Services[name] = st.String()
+			if st != healthpb.HealthCheckResponse_SERVING {
+				status = st
+			}
+		}
+	}
+	info.Status = status.String()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch status {
+	case healthpb.HealthCheckResponse_SERVING:
+	case healthpb.HealthCheckResponse_SERVICE_UNKNOWN:
+		w.WriteHeader(http.StatusNotFound)
+	default:
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	writeJSON(w, info)
+}
@@ -0,0 +1,313 @@
+package server
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// The environment of the systemd socket activation protocol, see sd_listen_fds(3).
+const (
+	envListenFDs     = "LISTEN_FDS"
+	envListenPID     = "LISTEN_PID"
+	envListenFDNames = "LISTEN_FDNAMES"
+	// listenFDsStart is the first passed file descriptor.
+	listenFDsStart = 3
+)
+
+// envReadyFD holds the file descriptor the process started by Upgrade
+// notifies its parent through once it is ready.
+const envReadyFD = "YUKI_READY_FD"
+
+// Names of the inherited listeners. Use them as FileDescriptorName
+// of the systemd socket units.
+const (
+	listenerNameGRPC  = "grpc"
+	listenerNameHTTP  = "http"
+	listenerNameAdmin = "admin"
+)
+
+// inheritedListenerNames are the names used for the listeners passed
+// without one of these names, in the order they are passed.
+// systemd names them after the socket unit unless FileDescriptorName is set.
+var inheritedListenerNames = []string{listenerNameGRPC, listenerNameHTTP, listenerNameAdmin}
+
+// inherited holds the files passed by systemd or by the parent process.
+type inherited struct {
+	listeners map[string]net.Listener
+	// ready is the pipe to notify the parent through, nil if the process
+	// wasn't started by Upgrade.
+	ready *os.File
+}
+
+// inheritFiles takes the listeners passed in the environment.
+// The variables are unset so the child processes don't inherit them.
+func inheritFiles() (*inherited, error) {
+	ret := &inherited{listeners: map[string]net.Listener{}}
+
+	if fd := os.Getenv(envReadyFD); fd != "" {
+		os.Unsetenv(envReadyFD)
+		n, err := strconv.Atoi(fd)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %v", envReadyFD)
+		}
+		ret.ready = os.NewFile(uintptr(n), "ready")
+	}
+
+	nfds, pid, names := os.Getenv(envListenFDs), os.Getenv(envListenPID), os.Getenv(envListenFDNames)
+	os.Unsetenv(envListenFDs)
+	os.Unsetenv(envListenPID)
+	os.Unsetenv(envListenFDNames)
+	if nfds == "" {
+		return ret, nil
+	}
+	// LISTEN_PID is not known to the parent when it passes the listeners
+	// by itself, so it is checked only if set
+	if pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		ret.closeReady()
+		return ret, nil
+	}
+
+	n, err := strconv.Atoi(nfds)
+	if err != nil {
+		ret.closeReady()
+		return nil, errors.Wrapf(err, "invalid %v", envListenFDs)
+	}
+	fdNames := listenerNames(n, strings.Split(names, ":"))
+	for i, name := range fdNames {
+		f := os.NewFile(uintptr(listenFDsStart+i), name)
+		// FileListener duplicates the descriptor
+		li, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			ret.Close()
+			ret.closeReady()
+			return nil, errors.Wrapf(err, "couldn't use inherited file descriptor %v", listenFDsStart+i)
+		}
+		if name == "" {
+			// not used by the server
+			li.Close()
+			continue
+		}
+		ret.listeners[name] = li
+	}
+	return ret, nil
+}
+
+// listenerNames returns the names of n passed listeners.
+// The listeners not named grpc, http or admin, or named as another
+// listener, take the names left in the order of inheritedListenerNames;
+// the rest are not used and get an empty name.
+func listenerNames(n int, passed []string) []string {
+	ret := make([]string, n)
+	taken := map[string]bool{}
+	for i := range ret {
+		if i < len(passed) && isListenerName(passed[i]) && !taken[passed[i]] {
+			ret[i] = passed[i]
+			taken[passed[i]] = true
+		}
+	}
+	left := make([]string, 0, len(inheritedListenerNames))
+	for _, name := range inheritedListenerNames {
+		if !taken[name] {
+			left = append(left, name)
+		}
+	}
+	for i := range ret {
+		if ret[i] == "" && len(left) > 0 {
+			ret[i], left = left[0], left[1:]
+		}
+	}
+	return ret
+}
+
+func isListenerName(name string) bool {
+	for _, n := range inheritedListenerNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// apply returns a copy of opts using the inherited listeners instead of
+// the ports.
+// The listeners set by options explicitly take precedence.
+func (i *inherited) apply(opts *serverOpts) *serverOpts {
+	ret := *opts
+	if li, ok := i.listeners[listenerNameGRPC]; ok && ret.RPCListener == nil {
+		ret.RPCListener = li
+		delete(i.listeners, listenerNameGRPC)
+	}
+	if li, ok := i.listeners[listenerNameHTTP]; ok && ret.HTTPListener == nil {
+		ret.HTTPListener = li
+		delete(i.listeners, listenerNameHTTP)
+	}
+	if li, ok := i.listeners[listenerNameAdmin]; ok && ret.AdminListener == nil && ret.AdminEnabled {
+		ret.AdminListener = li
+		delete(i.listeners, listenerNameAdmin)
+	}
+	return &ret
+}
+
+// Close closes the listeners that were not used.
+func (i *inherited) Close() {
+	for name, li := range i.listeners {
+		li.Close()
+		delete(i.listeners, name)
+	}
+}
+
+// notifyReady tells the parent process that the server is ready.
+func (i *inherited) notifyReady() {
+	if i == nil || i.ready == nil {
+		return
+	}
+	i.ready.Write([]byte{1})
+	i.ready.Close()
+}
+
+// closeReady closes the ready pipe without notifying the parent process,
+// so it stops waiting once the listeners can't be inherited.
+func (i *inherited) closeReady() {
+	if i.ready != nil {
+		i.ready.Close()
+		i.ready = nil
+	}
+}
+
+// filer is implemented by the listeners that can be passed to another
+// process: *net.TCPListener and *net.UnixListener.
+type filer interface {
+	File() (*os.File, error)
+}
+
+// files returns duplicates of the listeners' file descriptors and
+// their names.
+func (l *listenerSet) files() ([]*os.File, []string, error) {
+	var files []*os.File
+	var names []string
+	for _, name := range inheritedListenerNames {
+		li, ok := l.inheritable[name]
+		if !ok {
+			continue
+		}
+		fl, ok := li.(filer)
+		if !ok {
+			closeFiles(files)
+			return nil, nil, errors.Errorf("%v listener of type %T can't be inherited", name, li)
+		}
+		f, err := fl.File()
+		if err != nil {
+			closeFiles(files)
+			return nil, nil, errors.Wrapf(err, "couldn't get %v listener's file", name)
+		}
+		if ul, ok := li.(*net.UnixListener); ok {
+			// keep the socket for the new process
+			ul.SetUnlinkOnClose(false)
+		}
+		files = append(files, f)
+		names = append(names, name)
+	}
+	return files, names, nil
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
+
+// upgradeEnv returns the environment without the variables of the listeners
+// inherited by the current process, e.g. the LISTEN_PID set by systemd.
+func upgradeEnv(env []string) []string {
+	ret := make([]string, 0, len(env))
+	for _, kv := range env {
+		switch strings.SplitN(kv, "=", 2)[0] {
+		case envListenFDs, envListenPID, envListenFDNames, envReadyFD:
+			continue
+		}
+		ret = append(ret, kv)
+	}
+	return ret
+}
+
+// Upgrade starts a new process of the same executable with the same
+// arguments, passing it the listeners, waits until it is ready and shuts
+// the server down.
+// Connections are accepted by both processes until the old one stops,
+// so no connections are refused during the upgrade.
+// The new process must use WithInheritedListeners.
+// If the new process fails to start or exits before becoming ready,
+// the server keeps running and the error is returned.
+// ctx limits the wait for the new process, RunContext limits it by
+// the UpgradeTimeout. The shutdown that follows is limited by
+// the ShutdownTimeout as in Stop.
+func (s *Server) Upgrade(ctx context.Context) error {
+	s.mu.Lock()
+	listeners, stopping := s.listeners, s.stopping
+	s.mu.Unlock()
+	if listeners == nil || stopping {
+		return errors.New("server is not running")
+	}
+
+	files, names, err := listeners.files()
+	if err != nil {
+		return err
+	}
+	defer closeFiles(files)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return errors.Wrap(err, "couldn't create ready pipe")
+	}
+	defer r.Close()
+
+	exe, err := os.Executable()
+	if err != nil {
+		w.Close()
+		return errors.Wrap(err, "couldn't find executable")
+	}
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = append(files, w)
+	cmd.Env = append(upgradeEnv(os.Environ()),
+		envListenFDs+"="+strconv.Itoa(len(files)),
+		envListenFDNames+"="+strings.Join(names, ":"),
+		envReadyFD+"="+strconv.Itoa(listenFDsStart+len(files)),
+	)
+	err = cmd.Start()
+	w.Close()
+	setNonblock(files)
+	if err != nil {
+		return errors.Wrap(err, "couldn't start new process")
+	}
+
+	ready := make(chan error, 1)
+	go func() {
+		// EOF if the process exits without notifying
+		_, err := r.Read(make([]byte, 1))
+		ready <- err
+	}()
+
+	select {
+	case err = <-ready:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return errors.Wrap(err, "new process didn't become ready")
+	}
+	cmd.Process.Release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.ShutdownTimeout)
+	defer cancel()
+	return s.Shutdown(ctx)
+}
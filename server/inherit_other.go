@@ -0,0 +1,9 @@
+//go:build windows || plan9
+
+package server
+
+import "os"
+
+// setNonblock is a no-op, the listeners can't be passed to
+// another process on this platform.
+func setNonblock([]*os.File) {}
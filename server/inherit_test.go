@@ -0,0 +1,239 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"reflect"
+	"sort"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ra9form/yuki/server/log"
+)
+
+func Test_listenerNames(t *testing.T) {
+	tests := []struct {
+		name   string
+		n      int
+		passed string
+		want   []string
+	}{
+		{"unnamed", 2, "", []string{"grpc", "http"}},
+		{"named", 2, "http:grpc", []string{"http", "grpc"}},
+		{"unit names", 3, "app.socket:app.socket:app.socket", []string{"grpc", "http", "admin"}},
+		{"unknown", 2, "unknown:unknown", []string{"grpc", "http"}},
+		{"partly named", 2, "app.socket:grpc", []string{"http", "grpc"}},
+		{"duplicate", 2, "http:http", []string{"http", "grpc"}},
+		{"too many", 4, "", []string{"grpc", "http", "admin", ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := listenerNames(tt.n, strings.Split(tt.passed, ":"))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("listenerNames(%v, %q) = %q, want %q", tt.n, tt.passed, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_upgradeEnv(t *testing.T) {
+	got := upgradeEnv([]string{"PATH=/bin", "LISTEN_PID=1", "LISTEN_FDS=2", "LISTEN_FDNAMES=a:b", "YUKI_READY_FD=5", "LISTEN=x"})
+	want := []string{"PATH=/bin", "LISTEN=x"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("upgradeEnv() = %q, want %q", got, want)
+	}
+}
+
+// envInheritHelper makes the test binary print the listeners it inherits.
+const envInheritHelper = "YUKI_TEST_INHERIT_HELPER"
+
+func TestInheritHelper(t *testing.T) {
+	if os.Getenv(envInheritHelper) == "" {
+		t.Skip("run by Test_inheritFiles")
+	}
+	inh, err := inheritFiles()
+	if err != nil {
+		fmt.Println("error:", err)
+		return
+	}
+	for name, li := range inh.listeners {
+		fmt.Printf("listener %v %v\n", name, li.Addr())
+	}
+	inh.Close()
+	// keep running until the parent closes stdin
+	io.Copy(ioutil.Discard, os.Stdin)
+}
+
+func Test_inheritFiles(t *testing.T) {
+	newFile := func() (*os.File, string) {
+		li, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer li.Close()
+		f, err := li.(*net.TCPListener).File()
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { f.Close() })
+		return f, li.Addr().String()
+	}
+	first, firstAddr := newFile()
+	second, secondAddr := newFile()
+
+	tests := []struct {
+		name  string
+		env   []string
+		files []*os.File
+		want  []string
+	}{
+		{
+			name:  "unit name",
+			env:   []string{"LISTEN_FDS=1", "LISTEN_FDNAMES=app.socket"},
+			files: []*os.File{first},
+			want:  []string{"listener grpc " + firstAddr},
+		},
+		{
+			name:  "named",
+			env:   []string{"LISTEN_FDS=2", "LISTEN_FDNAMES=http:app.socket"},
+			files: []*os.File{first, second},
+			want:  []string{"listener grpc " + secondAddr, "listener http " + firstAddr},
+		},
+		{
+			name:  "other process",
+			env:   []string{"LISTEN_FDS=1", "LISTEN_PID=1"},
+			files: []*os.File{first},
+			want:  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command(os.Args[0], "-test.run=^TestInheritHelper$")
+			cmd.Env = append(upgradeEnv(os.Environ()), envInheritHelper+"=1")
+			cmd.Env = append(cmd.Env, tt.env...)
+			cmd.ExtraFiles = tt.files
+			out, err := cmd.Output()
+			if err != nil {
+				t.Fatalf("helper failed: %v\n%s", err, out)
+			}
+
+			var got []string
+			for _, line := range strings.Split(string(out), "\n") {
+				if strings.HasPrefix(line, "listener ") || strings.HasPrefix(line, "error:") {
+					got = append(got, line)
+				}
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("inherited %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_inheritFiles_readyClosed(t *testing.T) {
+	li, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := li.(*net.TCPListener).File()
+	li.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestInheritHelper$")
+	cmd.Env = append(upgradeEnv(os.Environ()), envInheritHelper+"=1",
+		"LISTEN_FDS=1", "LISTEN_PID=1", envReadyFD+"=4")
+	cmd.ExtraFiles = []*os.File{f, w}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	defer cmd.Wait()
+	defer stdin.Close()
+
+	read := make(chan error, 1)
+	go func() {
+		_, err := r.Read(make([]byte, 1))
+		read <- err
+	}()
+	select {
+	case err := <-read:
+		if err != io.EOF {
+			t.Errorf("ready pipe read error = %v, want EOF", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("ready pipe isn't closed while the process is running")
+	}
+}
+
+// envUpgradeHelper makes the test binary hang instead of becoming ready.
+const envUpgradeHelper = "YUKI_TEST_UPGRADE_HELPER"
+
+func TestUpgradeHelper(t *testing.T) {
+	if os.Getenv(envUpgradeHelper) == "" {
+		t.Skip("run by TestServer_upgradeTimeout")
+	}
+	time.Sleep(time.Minute)
+}
+
+func TestServer_upgradeTimeout(t *testing.T) {
+	args := os.Args
+	os.Args = []string{args[0], "-test.run=^TestUpgradeHelper$"}
+	defer func() { os.Args = args }()
+	t.Setenv(envUpgradeHelper, "1")
+
+	logs := &logBuffer{}
+	srv := NewServer(0,
+		WithUpgradeSignals(syscall.SIGUSR1),
+		WithUpgradeTimeout(200*time.Millisecond),
+		WithLogger(log.NewJSONLogger(logs)),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- srv.RunContext(ctx, testService{})
+	}()
+	<-srv.Ready()
+
+	syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+	deadline := time.Now().Add(10 * time.Second)
+	for !strings.Contains(logs.String(), "upgrade failed") {
+		if time.Now().After(deadline) {
+			t.Fatal("upgrade didn't time out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !strings.Contains(logs.String(), context.DeadlineExceeded.Error()) {
+		t.Errorf("upgrade failed with %s, want deadline exceeded", logs.String())
+	}
+
+	cancel()
+	select {
+	case err := <-runErr:
+		if err != nil {
+			t.Errorf("RunContext() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("RunContext() doesn't return after the upgrade")
+	}
+}
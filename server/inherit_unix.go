@@ -0,0 +1,23 @@
+//go:build !windows && !plan9
+
+package server
+
+import (
+	"os"
+	"syscall"
+)
+
+// setNonblock puts the files back into the non-blocking mode.
+// exec.Cmd makes the passed files blocking; the mode is shared with
+// the listeners they duplicate, whose Close would block on Accept.
+func setNonblock(files []*os.File) {
+	for _, f := range files {
+		rc, err := f.SyscallConn()
+		if err != nil {
+			continue
+		}
+		rc.Control(func(fd uintptr) {
+			syscall.SetNonblock(int(fd), true)
+		})
+	}
+}
@@ -1,61 +1,181 @@
 package server
 
 import (
+	"crypto/tls"
+	goerrors "errors"
 	"net"
 	"strconv"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/pkg/errors"
 	"github.com/soheilhy/cmux"
 )
 
-const (
-	listenRetryWait     = 500 * time.Millisecond
-	listenRetryDuration = 10 * time.Second
-)
-
 type listenerSet struct {
 	mainListener cmux.CMux // nil or CMux. If nil - don't listen
 	HTTP         net.Listener
 	GRPC         net.Listener
+	Admin        net.Listener // nil if admin server is disabled
+
+	// tls is the config used for the public listeners, nil if TLS is disabled.
+	tls *tls.Config
+	// proxy enables PROXY protocol on the public listeners.
+	proxy bool
+	// proxyTrusted are the networks PROXY protocol headers are accepted from.
+	proxyTrusted []*net.IPNet
+
+	// roots are the public listeners bound by the set; closing them stops
+	// every listener derived from them (including the cmux ones).
+	roots []net.Listener
+
+	// inheritable are the bound listeners by their names, before TLS
+	// termination; they are passed to the process started by Upgrade.
+	inheritable map[string]net.Listener
 }
 
 func newListenerSet(opts *serverOpts) (*listenerSet, error) {
-	liSet := &listenerSet{}
+	liSet := &listenerSet{inheritable: map[string]net.Listener{}}
 	var err error
 
-	liSet.GRPC, err = newListener(opts.RPCPort)
+	liSet.tls, err = opts.tlsConfig()
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't set up TLS")
+	}
+	if opts.ProxyProtocol {
+		liSet.proxy = true
+		liSet.proxyTrusted, err = parseCIDRs(opts.ProxyTrustedCIDRs)
+		if err != nil {
+			return nil, errors.Wrap(err, "couldn't set up PROXY protocol")
+		}
+	}
+
+	liSet.GRPC, err = liSet.public(listenerNameGRPC, opts.RPCListener, opts.RPCPort, opts.ListenRetry)
 	if err != nil {
 		return nil, errors.Wrap(err, "couldn't create main listener")
 	}
 
-	if opts.RPCPort == opts.HTTPPort {
-		mux := cmux.New(liSet.GRPC)
-		liSet.GRPC = mux.Match(cmux.HTTP2())
-		liSet.HTTP = mux.Match(cmux.Any())
+	switch {
+	case opts.HTTPListener == nil && opts.RPCPort == opts.HTTPPort:
+		sniffing := newSniffingListener(liSet.GRPC)
+		liSet.roots = append(liSet.roots, sniffing)
+		mux := cmux.New(sniffing)
+		liSet.GRPC = sniffing.matched(mux.MatchWithWriters(matchGRPC()))
+		liSet.HTTP = httpListener{sniffing.matched(mux.Match(cmux.Any()))}
 		liSet.mainListener = mux
-	} else {
-		liSet.HTTP, err = newListener(opts.HTTPPort)
+	default:
+		liSet.HTTP, err = liSet.public(listenerNameHTTP, opts.HTTPListener, opts.HTTPPort, opts.ListenRetry)
 	}
 	if err != nil {
+		liSet.Close()
 		return nil, errors.Wrap(err, "couldn't create HTTP listener")
 	}
 
+	if li := opts.AdminListener; li != nil || opts.AdminEnabled {
+		if li == nil {
+			li, err = newListener(opts.AdminPort, opts.ListenRetry)
+			if err != nil {
+				liSet.Close()
+				return nil, errors.Wrap(err, "couldn't create admin listener")
+			}
+		}
+		liSet.inheritable[listenerNameAdmin] = li
+		liSet.Admin = &onceCloseListener{Listener: li}
+	}
+
 	return liSet, nil
 }
 
-// newListener start net.Listener on a port.
-// It keeps retrying if port is already in use.
-func newListener(port int) (net.Listener, error) {
-	var listener net.Listener
-	var err error
+// public returns a new public listener; it uses li if it is not nil or
+// listens on a port otherwise.
+// PROXY protocol is parsed and TLS is terminated by the listener if enabled.
+func (l *listenerSet) public(name string, li net.Listener, port int, retry ListenRetry) (net.Listener, error) {
+	if li == nil {
+		var err error
+		li, err = newListener(port, retry)
+		if err != nil {
+			return nil, err
+		}
+	}
+	l.inheritable[name] = li
+	if l.proxy {
+		// the header precedes TLS handshake and protocol detection
+		li = &proxyListener{Listener: li, trusted: l.proxyTrusted}
+	}
+	if l.tls != nil {
+		li = tls.NewListener(li, l.tls)
+	}
+	ret := &onceCloseListener{Listener: li}
+	l.roots = append(l.roots, ret)
+	return ret, nil
+}
+
+// Close stops accepting connections on every listener of the set.
+func (l *listenerSet) Close() error {
+	err := l.ClosePublic()
+	if l.Admin != nil {
+		if aerr := l.Admin.Close(); err == nil {
+			err = aerr
+		}
+	}
+	return err
+}
+
+// ClosePublic stops accepting connections on the HTTP and gRPC listeners.
+// Muxed listeners are stopped as well, which makes the cmux return.
+func (l *listenerSet) ClosePublic() error {
+	var ret error
+	for _, li := range l.roots {
+		if err := li.Close(); err != nil && ret == nil {
+			ret = err
+		}
+	}
+	return ret
+}
+
+// ListenRetry is the policy of retrying to listen on a port which is
+// already in use.
+type ListenRetry struct {
+	// Wait is the pause between attempts.
+	Wait time.Duration
+	// Timeout is the total time to keep retrying; zero disables retries.
+	Timeout time.Duration
+}
+
+// newListener starts net.Listener on a TCP port.
+// It keeps retrying according to the policy if the port is already in use.
+func newListener(port int, retry ListenRetry) (net.Listener, error) {
+	addr := net.JoinHostPort("", strconv.Itoa(port))
 	start := time.Now()
-	for time.Since(start) < listenRetryDuration {
-		listener, err = net.Listen("tcp", net.JoinHostPort("", strconv.Itoa(port)))
+	for {
+		listener, err := net.Listen("tcp", addr)
 		if err == nil {
 			return listener, nil
 		}
-		time.Sleep(listenRetryWait)
+		if !goerrors.Is(err, syscall.EADDRINUSE) || retry.Timeout <= 0 {
+			return nil, errors.Wrapf(err, "couldn't listen on port %v", port)
+		}
+		if time.Since(start)+retry.Wait > retry.Timeout {
+			return nil, errors.Wrapf(err, "couldn't listen on port %v, retried for %v", port, retry.Timeout)
+		}
+		time.Sleep(retry.Wait)
 	}
-	return nil, err
+}
+
+// onceCloseListener wraps a net.Listener, protecting it from
+// multiple Close calls.
+// Both HTTP and gRPC servers close their listeners on shutdown, and
+// muxed listeners share the same root.
+type onceCloseListener struct {
+	net.Listener
+	once     sync.Once
+	closeErr error
+}
+
+func (l *onceCloseListener) Close() error {
+	l.once.Do(func() {
+		l.closeErr = l.Listener.Close()
+	})
+	return l.closeErr
 }
@@ -0,0 +1,80 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+)
+
+// FromWriter adapts the Writer to the Logger.
+// The fields are appended to the message in logfmt.
+// WriterC is used if w implements it.
+func FromWriter(w Writer) Logger {
+	if l, ok := w.(loggerWriter); ok {
+		return l.l
+	}
+	wc, _ := w.(WriterC)
+	return writerLogger{w: w, wc: wc}
+}
+
+// FromWriterC adapts the WriterC to the Logger.
+// The fields are appended to the message in logfmt.
+func FromWriterC(w WriterC) Logger {
+	if l, ok := w.(loggerWriter); ok {
+		return l.l
+	}
+	return writerLogger{wc: w}
+}
+
+type writerLogger struct {
+	w  Writer
+	wc WriterC
+}
+
+func (l writerLogger) Log(ctx context.Context, level Level, msg string, fields ...Field) {
+	ctxFields := FieldsFromContext(ctx)
+	all := make([]Field, 0, len(ctxFields)+len(fields))
+	all = append(append(all, ctxFields...), fields...)
+	if len(all) > 0 {
+		var buf bytes.Buffer
+		buf.WriteString(msg)
+		buf.WriteByte(' ')
+		encodeLogfmt(&buf, all)
+		msg = buf.String()
+	}
+
+	if l.wc != nil {
+		l.wc.Logc(ctx, level, msg)
+		return
+	}
+	l.w.Log(level, msg)
+}
+
+// ToWriter adapts the Logger to the Writer.
+// The returned Writer implements WriterC as well.
+func ToWriter(l Logger) Writer {
+	if wl, ok := l.(writerLogger); ok && wl.w != nil {
+		return wl.w
+	}
+	return loggerWriter{l: l}
+}
+
+type loggerWriter struct {
+	l Logger
+}
+
+func (w loggerWriter) Log(level Level, args ...interface{}) {
+	w.l.Log(context.Background(), level, fmt.Sprint(args...))
+}
+
+func (w loggerWriter) Logf(level Level, format string, args ...interface{}) {
+	w.l.Log(context.Background(), level, fmt.Sprintf(format, args...))
+}
+
+func (w loggerWriter) Logc(ctx context.Context, level Level, args ...interface{}) {
+	w.l.Log(ctx, level, fmt.Sprint(args...))
+}
+
+func (w loggerWriter) Logcf(ctx context.Context, level Level, format string, args ...interface{}) {
+	w.l.Log(ctx, level, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,125 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// NewJSONLogger returns the Logger writing a JSON object per message:
+// {"time":...,"level":...,"msg":...,<fields>}.
+// LevelFatal messages are written as the others, the process isn't exited.
+func NewJSONLogger(w io.Writer) Logger {
+	return &encoderLogger{w: w, encode: encodeJSON}
+}
+
+// NewLogfmtLogger returns the Logger writing a logfmt line per message:
+// time=... level=... msg=... <fields>.
+// LevelFatal messages are written as the others, the process isn't exited.
+func NewLogfmtLogger(w io.Writer) Logger {
+	return &encoderLogger{w: w, encode: encodeLogfmt}
+}
+
+// encoderLogger writes the messages encoded by the encode func.
+type encoderLogger struct {
+	mu     sync.Mutex
+	w      io.Writer
+	encode func(buf *bytes.Buffer, fields []Field)
+}
+
+func (l *encoderLogger) Log(ctx context.Context, level Level, msg string, fields ...Field) {
+	ctxFields := FieldsFromContext(ctx)
+	all := make([]Field, 0, 3+len(ctxFields)+len(fields))
+	all = append(all,
+		F("time", time.Now().Format(time.RFC3339Nano)),
+		F("level", level.String()),
+		F("msg", msg),
+	)
+	all = append(append(all, ctxFields...), fields...)
+
+	var buf bytes.Buffer
+	l.encode(&buf, all)
+	buf.WriteByte('\n')
+
+	l.mu.Lock()
+	l.w.Write(buf.Bytes())
+	l.mu.Unlock()
+}
+
+func encodeJSON(buf *bytes.Buffer, fields []Field) {
+	buf.WriteByte('{')
+	for i, f := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(f.Key)
+		buf.Write(key)
+		buf.WriteByte(':')
+
+		v, err := json.Marshal(jsonValue(f.Value))
+		if err != nil {
+			v, _ = json.Marshal(fmt.Sprint(f.Value))
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+}
+
+// jsonValue converts the values that don't marshal to JSON meaningfully.
+func jsonValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return v
+}
+
+func encodeLogfmt(buf *bytes.Buffer, fields []Field) {
+	for i, f := range fields {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(logfmtKey(f.Key))
+		buf.WriteByte('=')
+		buf.WriteString(logfmtValue(f.Value))
+	}
+}
+
+// logfmtKey removes the characters that can't be used in keys.
+func logfmtKey(k string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' || r == unicode.ReplacementChar {
+			return '_'
+		}
+		return r
+	}, k)
+}
+
+func logfmtValue(v interface{}) string {
+	var s string
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		s = v
+	case error:
+		s = v.Error()
+	case fmt.Stringer:
+		s = v.String()
+	default:
+		s = fmt.Sprint(v)
+	}
+	if s == "" || strings.ContainsAny(s, " =\"\\") || strings.IndexFunc(s, unicode.IsControl) >= 0 {
+		return strconv.Quote(s)
+	}
+	return s
+}
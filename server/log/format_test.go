@@ -0,0 +1,57 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNewJSONLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewJSONLogger(&buf)
+
+	ctx := WithFields(context.Background(), F("request_id", "42"))
+	l.Log(ctx, LevelError, "failed", Err(errors.New("boom")), F("attempt", 2))
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("invalid JSON %q: %v", buf.String(), err)
+	}
+	want := map[string]interface{}{
+		"level":      "error",
+		"msg":        "failed",
+		"request_id": "42",
+		"error":      "boom",
+		"attempt":    float64(2),
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%v = %v, want %v", k, got[k], v)
+		}
+	}
+}
+
+func TestNewLogfmtLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewLevelFilter(NewLogfmtLogger(&buf), LevelInfo)
+
+	l.Log(context.Background(), LevelDebug, "dropped")
+	l.Log(context.Background(), LevelInfo, "hello world", F("path", "/v1/x"), F("empty", ""))
+	// the test binary would exit here if LevelFatal exited
+	l.Log(context.Background(), LevelFatal, "fatal")
+
+	got := buf.String()
+	if strings.Contains(got, "dropped") {
+		t.Errorf("debug message wasn't filtered: %q", got)
+	}
+	want := ` level=info msg="hello world" path=/v1/x empty=""` + "\n"
+	if !strings.Contains(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if !strings.HasSuffix(got, " level=fatal msg=fatal\n") {
+		t.Errorf("got %q, want the fatal message last", got)
+	}
+}
@@ -15,11 +15,14 @@ const (
 	LevelWarning
 	// LevelError used for error messages.
 	LevelError
-	// LevelFatal used for fatal messages. os.Exit(1) is called after printing.
+	// LevelFatal used for fatal messages. Only Default calls os.Exit(1)
+	// after printing, kept for compatibility; the Loggers of this package
+	// never exit, the adapters (FromWriter, FromSlog) leave it to the backend.
 	LevelFatal
 )
 
 // Writer accepts messages along with the Level.
+// Use FromWriter to pass it where Logger is required.
 type Writer interface {
 	Log(Level, ...interface{})
 	Logf(Level, string, ...interface{})
@@ -31,5 +34,7 @@ type WriterC interface {
 	Logcf(context.Context, Level, string, ...interface{})
 }
 
-// Default is the default logger.
+// Default is the default Writer.
+// It is kept for compatibility, the server uses DefaultLogger.
+// Unlike DefaultLogger, it writes to stdout.
 var Default Writer
@@ -0,0 +1,46 @@
+//go:build go1.21
+
+package log
+
+import (
+	"context"
+	"log/slog"
+)
+
+// FromSlog adapts the slog.Logger to the Logger.
+// LevelFatal is logged at the level above slog.LevelError.
+func FromSlog(l *slog.Logger) Logger {
+	return slogLogger{l: l}
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func (s slogLogger) Log(ctx context.Context, level Level, msg string, fields ...Field) {
+	ctxFields := FieldsFromContext(ctx)
+	attrs := make([]slog.Attr, 0, len(ctxFields)+len(fields))
+	for _, f := range ctxFields {
+		attrs = append(attrs, slog.Any(f.Key, f.Value))
+	}
+	for _, f := range fields {
+		attrs = append(attrs, slog.Any(f.Key, f.Value))
+	}
+	s.l.LogAttrs(ctx, slogLevel(level), msg, attrs...)
+}
+
+func slogLevel(l Level) slog.Level {
+	switch l {
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelInfo:
+		return slog.LevelInfo
+	case LevelWarning:
+		return slog.LevelWarn
+	case LevelError:
+		return slog.LevelError
+	case LevelFatal:
+		return slog.LevelError + 4
+	}
+	return slog.LevelInfo
+}
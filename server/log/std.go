@@ -0,0 +1,30 @@
+package log
+
+import (
+	"context"
+	"log"
+	"strings"
+)
+
+// NewStdLogger returns the standard library logger that writes messages
+// to the Writer at the Level.
+// Use it to route the errors of net/http servers and similar libraries.
+func NewStdLogger(w Writer, l Level) *log.Logger {
+	return StdLogger(FromWriter(w), l)
+}
+
+// StdLogger returns the standard library logger that writes messages
+// to the Logger at the Level.
+func StdLogger(l Logger, level Level) *log.Logger {
+	return log.New(stdWriter{l: l, level: level}, "", 0)
+}
+
+type stdWriter struct {
+	l     Logger
+	level Level
+}
+
+func (s stdWriter) Write(p []byte) (int, error) {
+	s.l.Log(context.Background(), s.level, strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
@@ -0,0 +1,79 @@
+package log
+
+import (
+	"context"
+	"os"
+)
+
+// Logger writes structured messages.
+// Implementations add the fields carried by ctx, see WithFields.
+type Logger interface {
+	Log(ctx context.Context, level Level, msg string, fields ...Field)
+}
+
+// Field is a key/value pair attached to a message.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F creates a Field.
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Err creates the "error" Field.
+func Err(err error) Field {
+	return Field{Key: "error", Value: err}
+}
+
+// DefaultLogger is the Logger used by the server unless another one
+// is passed. It writes logfmt to stderr, unlike Default writing to stdout,
+// and doesn't exit on LevelFatal.
+var DefaultLogger Logger = NewLogfmtLogger(os.Stderr)
+
+type fieldsKey struct{}
+
+// WithFields returns a context carrying the fields in addition to the
+// ones carried by ctx already.
+// The fields are added to every message logged with the context.
+func WithFields(ctx context.Context, fields ...Field) context.Context {
+	if len(fields) == 0 {
+		return ctx
+	}
+	prev := FieldsFromContext(ctx)
+	all := make([]Field, 0, len(prev)+len(fields))
+	all = append(append(all, prev...), fields...)
+	return context.WithValue(ctx, fieldsKey{}, all)
+}
+
+// FieldsFromContext returns the fields carried by the context.
+func FieldsFromContext(ctx context.Context) []Field {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(fieldsKey{}).([]Field)
+	return fields
+}
+
+// NewLevelFilter returns the Logger dropping the messages below min level.
+func NewLevelFilter(l Logger, min Level) Logger {
+	return levelFilter{l: l, min: min}
+}
+
+type levelFilter struct {
+	l   Logger
+	min Level
+}
+
+func (f levelFilter) Log(ctx context.Context, level Level, msg string, fields ...Field) {
+	if level < f.min {
+		return
+	}
+	f.l.Log(ctx, level, msg, fields...)
+}
+
+// String returns the lowercase level name.
+func (l Level) String() string {
+	return levelToString(l)
+}
@@ -0,0 +1,188 @@
+package mwaccesslog
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/ra9form/yuki/server/log"
+	"github.com/ra9form/yuki/server/middlewares/mwcommon"
+	"github.com/ra9form/yuki/transport/httptransport"
+	"github.com/ra9form/yuki/transport/requestid"
+)
+
+// Field keys of the access log record.
+const (
+	FieldMethod       = "method"
+	FieldTransport    = "transport"
+	FieldBinding      = "binding"
+	FieldCode         = "code"
+	FieldStatus       = "status"
+	FieldDuration     = "duration"
+	FieldRequestSize  = "request_size"
+	FieldResponseSize = "response_size"
+	FieldPeer         = "peer"
+	FieldRequestID    = "request_id"
+	FieldSlow         = "slow"
+)
+
+// Message is the message of the access log records.
+const Message = "access"
+
+type options struct {
+	sampleRate float64
+	slow       time.Duration
+	random     func() float64
+}
+
+// Option configures the access log.
+type Option func(*options)
+
+// WithSampling logs only a fraction (0..1) of the successful calls.
+// Failed and slow calls are always logged.
+// Every call is logged by default.
+func WithSampling(rate float64) Option {
+	return func(o *options) {
+		o.sampleRate = rate
+	}
+}
+
+// WithSlowThreshold makes the calls taking longer than d be always
+// logged at the warning level, marked as slow.
+func WithSlowThreshold(d time.Duration) Option {
+	return func(o *options) {
+		o.slow = d
+	}
+}
+
+// UnaryServerInterceptor logs a record per unary call.
+// Since the generated HTTP handlers call the service through the unary
+// interceptor, HTTP-transcoded calls are logged with the same fields;
+// the binding is set for them and the transport is "http".
+// Request and response sizes are the sizes of the protobuf messages
+// for both transports.
+//
+// Successful calls are logged at the info level, slow ones at the warning
+// level and the ones failed with Internal, Unknown or DataLoss codes
+// at the error level. Panicking calls are logged as failed with Internal
+// before the panic reaches the recovery middlewares.
+// logger is converted by mwcommon.GetLogger.
+func UnaryServerInterceptor(logger interface{}, opts ...Option) grpc.UnaryServerInterceptor {
+	a := newAccessLog(logger, opts)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (rsp interface{}, err error) {
+		start := time.Now()
+		defer func() {
+			a.logCall(ctx, info.FullMethod, start, err, recover(), messageSize(req), messageSize(rsp))
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor logs a record per streaming call.
+// Message sizes are not recorded for streams.
+func StreamServerInterceptor(logger interface{}, opts ...Option) grpc.StreamServerInterceptor {
+	a := newAccessLog(logger, opts)
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		start := time.Now()
+		defer func() {
+			a.logCall(stream.Context(), info.FullMethod, start, err, recover(), 0, 0)
+		}()
+		return handler(srv, stream)
+	}
+}
+
+type accessLog struct {
+	logger log.Logger
+	opts   options
+}
+
+func newAccessLog(logger interface{}, opts []Option) *accessLog {
+	a := &accessLog{
+		logger: mwcommon.GetLogger(logger),
+		opts:   options{sampleRate: 1, random: rand.Float64},
+	}
+	for _, o := range opts {
+		o(&a.opts)
+	}
+	return a
+}
+
+// logCall logs the call, the panicking ones are logged as failed
+// with Internal before re-panicking with rec.
+func (a *accessLog) logCall(ctx context.Context, method string, start time.Time, err error, rec interface{}, reqSize, rspSize int) {
+	if rec != nil {
+		err = status.Errorf(codes.Internal, "panic: %v", rec)
+	}
+	a.log(ctx, method, start, err, reqSize, rspSize)
+	if rec != nil {
+		panic(rec)
+	}
+}
+
+func (a *accessLog) log(ctx context.Context, method string, start time.Time, err error, reqSize, rspSize int) {
+	duration := time.Since(start)
+	code := status.Code(err)
+	slow := a.opts.slow > 0 && duration > a.opts.slow
+
+	var level log.Level = log.LevelInfo
+	switch {
+	case code == codes.Internal || code == codes.Unknown || code == codes.DataLoss:
+		level = log.LevelError
+	case slow:
+		level = log.LevelWarning
+	case code == codes.OK && a.opts.sampleRate < 1 && a.opts.random() >= a.opts.sampleRate:
+		return
+	}
+
+	transport, binding := "grpc", ""
+	if b, ok := httptransport.BindingFromContext(ctx); ok {
+		transport, binding = "http", b.String()
+	}
+	peerAddr := ""
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		peerAddr = p.Addr.String()
+	}
+	fields := []log.Field{
+		log.F(FieldMethod, method),
+		log.F(FieldTransport, transport),
+		log.F(FieldBinding, binding),
+		log.F(FieldCode, code.String()),
+		log.F(FieldStatus, runtime.HTTPStatusFromCode(code)),
+		log.F(FieldDuration, duration.Seconds()),
+		log.F(FieldRequestSize, reqSize),
+		log.F(FieldResponseSize, rspSize),
+		log.F(FieldPeer, peerAddr),
+	}
+	// the request ID set by the request ID middlewares is logged
+	// along with the context's fields
+	if _, ok := requestid.FromContext(ctx); !ok {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if vv := md.Get(requestid.MDKey); len(vv) > 0 && requestid.Valid(vv[0]) {
+				fields = append(fields, log.F(FieldRequestID, vv[0]))
+			}
+		}
+	}
+	if slow {
+		fields = append(fields, log.F(FieldSlow, true))
+	}
+	if err != nil {
+		fields = append(fields, log.Err(err))
+	}
+	a.logger.Log(ctx, level, Message, fields...)
+}
+
+// messageSize returns the size of the protobuf message, 0 for other values.
+func messageSize(m interface{}) int {
+	if pm, ok := m.(proto.Message); ok {
+		return proto.Size(pm)
+	}
+	return 0
+}
@@ -0,0 +1,104 @@
+package mwaccesslog
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/ra9form/yuki/server/log"
+	"github.com/ra9form/yuki/transport/httptransport"
+)
+
+type record struct {
+	level  log.Level
+	fields map[string]interface{}
+}
+
+type testLogger struct {
+	records []record
+}
+
+func (l *testLogger) Log(_ context.Context, level log.Level, _ string, fields ...log.Field) {
+	r := record{level: level, fields: map[string]interface{}{}}
+	for _, f := range fields {
+		r.fields[f.Key] = f.Value
+	}
+	l.records = append(l.records, r)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/strings.Strings/ToUpper"}
+	ok := func(context.Context, interface{}) (interface{}, error) { return nil, nil }
+	slow := func(context.Context, interface{}) (interface{}, error) {
+		time.Sleep(20 * time.Millisecond)
+		return nil, nil
+	}
+	fail := func(context.Context, interface{}) (interface{}, error) {
+		return nil, status.Error(codes.Internal, "boom")
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-request-id", "42"))
+	httpCtx := httptransport.NewBindingContext(ctx, httptransport.Binding{Method: "POST", Pattern: "/strings/to_upper"})
+
+	l := &testLogger{}
+	mw := UnaryServerInterceptor(l, WithSampling(0), WithSlowThreshold(10*time.Millisecond))
+	// sampled out
+	mw(ctx, nil, info, ok)
+	mw(httpCtx, nil, info, slow)
+	mw(httpCtx, nil, info, fail)
+
+	if len(l.records) != 2 {
+		t.Fatalf("got %v records, want 2", len(l.records))
+	}
+	recs := l.records
+
+	if r := recs[0]; r.level != log.LevelWarning || r.fields[FieldSlow] != true {
+		t.Errorf("slow call record = %v %v, want warning marked as slow", r.level, r.fields)
+	}
+	r := recs[1]
+	if r.level != log.LevelError {
+		t.Errorf("failed call level = %v, want error", r.level)
+	}
+	want := map[string]interface{}{
+		FieldMethod:    info.FullMethod,
+		FieldTransport: "http",
+		FieldBinding:   "POST /strings/to_upper",
+		FieldCode:      "Internal",
+		FieldStatus:    500,
+		FieldRequestID: "42",
+	}
+	for k, v := range want {
+		if r.fields[k] != v {
+			t.Errorf("%v = %v, want %v", k, r.fields[k], v)
+		}
+	}
+}
+
+func TestUnaryServerInterceptorPanic(t *testing.T) {
+	info := &grpc.UnaryServerInfo{FullMethod: "/strings.Strings/ToUpper"}
+	l := &testLogger{}
+	mw := UnaryServerInterceptor(l)
+
+	func() {
+		defer func() {
+			if rec := recover(); rec != "boom" {
+				t.Errorf("recovered %v, want the handler's panic", rec)
+			}
+		}()
+		mw(context.Background(), nil, info, func(context.Context, interface{}) (interface{}, error) {
+			panic("boom")
+		})
+	}()
+
+	if len(l.records) != 1 {
+		t.Fatalf("got %v records, want 1", len(l.records))
+	}
+	if r := l.records[0]; r.level != log.LevelError || r.fields[FieldCode] != "Internal" {
+		t.Errorf("panicking call record = %v %v, want error with Internal", r.level, r.fields)
+	}
+}
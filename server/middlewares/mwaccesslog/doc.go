@@ -0,0 +1,2 @@
+/*Package mwaccesslog provides access logging middlewares writing the same record for gRPC and HTTP-transcoded calls.*/
+package mwaccesslog
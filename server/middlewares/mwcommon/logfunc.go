@@ -2,22 +2,40 @@ package mwcommon
 
 import (
 	"context"
-	"fmt"
+	stdlog "log"
 	"reflect"
 
 	"github.com/ra9form/yuki/server/log"
 )
 
-func GetLogFunc(logger interface{}) func(context.Context, string) {
-	if logger, ok := logger.(log.Writer); ok {
-		return func(_ context.Context, s string) {
-			logger.Log(log.LevelError, s)
-		}
+// GetLogger converts the logger passed to the middlewares to log.Logger.
+// It accepts log.Logger, log.Writer, log.WriterC and *log.Logger of
+// the standard library. log.DefaultLogger is used for nil and for
+// unsupported types; a warning is logged in the latter case.
+func GetLogger(logger interface{}) log.Logger {
+	switch l := logger.(type) {
+	case nil:
+		return log.DefaultLogger
+	case log.Logger:
+		return l
+	case log.Writer:
+		return log.FromWriter(l)
+	case log.WriterC:
+		return log.FromWriterC(l)
+	case *stdlog.Logger:
+		return log.NewLogfmtLogger(l.Writer())
 	}
-	if logger, ok := logger.(log.WriterC); ok {
-		return func(ctx context.Context, s string) {
-			logger.Logc(ctx, log.LevelError, s)
-		}
+	log.DefaultLogger.Log(context.Background(), log.LevelWarning,
+		"unsupported logger type, using the default logger",
+		log.F("type", reflect.TypeOf(logger).String()),
+	)
+	return log.DefaultLogger
+}
+
+// GetLogFunc returns the func logging errors to the logger, see GetLogger.
+func GetLogFunc(logger interface{}) func(context.Context, string) {
+	l := GetLogger(logger)
+	return func(ctx context.Context, s string) {
+		l.Log(ctx, log.LevelError, s)
 	}
-	panic(fmt.Sprintf("Bad type passed to getLogFunc: %v", reflect.TypeOf(logger)))
 }
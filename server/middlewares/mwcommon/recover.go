@@ -0,0 +1,72 @@
+package mwcommon
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/ra9form/yuki/server/log"
+	"github.com/ra9form/yuki/transport/httpruntime"
+	"github.com/ra9form/yuki/transport/requestid"
+)
+
+// PanicHook is called for every recovered panic, e.g. to report it
+// to an error tracker or to count it.
+// id is the correlation ID returned to the client.
+type PanicHook func(ctx context.Context, id string, rec interface{}, stack []byte)
+
+// RecoverOption configures the recovery middlewares.
+type RecoverOption func(*RecoverOpts)
+
+// RecoverOpts are the options of the recovery middlewares.
+type RecoverOpts struct {
+	Hooks []PanicHook
+	// ErrorWriter outputs the errors of the HTTP middleware,
+	// httpruntime.SetError is used if nil.
+	ErrorWriter httpruntime.ErrorWriter
+}
+
+// WithPanicHook adds a hook called for every recovered panic.
+func WithPanicHook(h PanicHook) RecoverOption {
+	return func(o *RecoverOpts) {
+		o.Hooks = append(o.Hooks, h)
+	}
+}
+
+// NewRecoverOpts applies the options.
+func NewRecoverOpts(opts ...RecoverOption) *RecoverOpts {
+	o := &RecoverOpts{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Recovered logs the panic with its stack, calls the hooks and returns
+// the error to pass to the client.
+// The error is a generic Internal error carrying only the correlation ID,
+// the request ID if there is one, so the panic can be found in the logs.
+func Recovered(ctx context.Context, logger log.Logger, opts *RecoverOpts, rec interface{}, stack []byte) error {
+	id, ok := requestid.FromContext(ctx)
+	if !ok {
+		id = requestid.New()
+	}
+
+	logger.Log(ctx, log.LevelError, "recovered from panic",
+		log.F("panic", fmt.Sprint(rec)),
+		log.F("stack", string(stack)),
+		log.F("correlation_id", id),
+	)
+	for _, h := range opts.Hooks {
+		h(ctx, id, rec, stack)
+	}
+
+	st := status.Newf(codes.Internal, "internal error, correlation ID %v", id)
+	if withDetails, err := st.WithDetails(&errdetails.RequestInfo{RequestId: id}); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
@@ -1,24 +1,23 @@
 package mwgrpc
 
 import (
-	"fmt"
 	"runtime/debug"
 
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
 
 	"github.com/ra9form/yuki/server/middlewares/mwcommon"
 )
 
 // UnaryPanicHandler handles panics for UnaryHandlers.
-func UnaryPanicHandler(logger interface{}) grpc.UnaryServerInterceptor {
-	logFunc := mwcommon.GetLogFunc(logger)
+// The panic and its stack are logged, the client gets a generic
+// Internal error with a correlation ID (see mwcommon.Recovered).
+func UnaryPanicHandler(logger interface{}, opts ...mwcommon.RecoverOption) grpc.UnaryServerInterceptor {
+	l, o := mwcommon.GetLogger(logger), mwcommon.NewRecoverOpts(opts...)
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
 		defer func() {
 			if r := recover(); r != nil {
-				err = grpc.Errorf(codes.Internal, "panic: %v", r)
-				logFunc(ctx, fmt.Sprintf("recovered from panic: %v,\n%v ", r, string(debug.Stack())))
+				err = mwcommon.Recovered(ctx, l, o, r, debug.Stack())
 			}
 		}()
 		return handler(ctx, req)
@@ -26,13 +25,12 @@ func UnaryPanicHandler(logger interface{}) grpc.UnaryServerInterceptor {
 }
 
 // StreamPanicHandler handles panics for StreamHandlers.
-func StreamPanicHandler(logger interface{}) grpc.StreamServerInterceptor {
-	logFunc := mwcommon.GetLogFunc(logger)
+func StreamPanicHandler(logger interface{}, opts ...mwcommon.RecoverOption) grpc.StreamServerInterceptor {
+	l, o := mwcommon.GetLogger(logger), mwcommon.NewRecoverOpts(opts...)
 	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
 		defer func() {
 			if r := recover(); r != nil {
-				err = grpc.Errorf(codes.Internal, "panic: %v", r)
-				logFunc(stream.Context(), fmt.Sprintf("recovered from panic: %v, %v ", r, string(debug.Stack())))
+				err = mwcommon.Recovered(stream.Context(), l, o, r, debug.Stack())
 			}
 		}()
 
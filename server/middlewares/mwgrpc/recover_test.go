@@ -0,0 +1,51 @@
+package mwgrpc
+
+import (
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/ra9form/yuki/server/log"
+	"github.com/ra9form/yuki/server/middlewares/mwcommon"
+	"github.com/ra9form/yuki/transport/requestid"
+)
+
+func TestUnaryPanicHandler(t *testing.T) {
+	var hooked string
+	hook := func(_ context.Context, id string, rec interface{}, stack []byte) {
+		hooked = id
+		if rec != "secret" || len(stack) == 0 {
+			t.Errorf("hook got %v, %d bytes of stack", rec, len(stack))
+		}
+	}
+
+	ctx := requestid.NewContext(context.Background(), "42")
+	_, err := UnaryPanicHandler(log.NewJSONLogger(ioutil.Discard), mwcommon.WithPanicHook(hook))(ctx, nil, &grpc.UnaryServerInfo{},
+		func(context.Context, interface{}) (interface{}, error) {
+			panic("secret")
+		})
+
+	st := status.Convert(err)
+	if st.Code() != codes.Internal {
+		t.Fatalf("code = %v, want Internal", st.Code())
+	}
+	if strings.Contains(st.Message(), "secret") || strings.Contains(st.Message(), "goroutine") {
+		t.Errorf("message %q leaks the panic", st.Message())
+	}
+	details := st.Details()
+	if len(details) != 1 {
+		t.Fatalf("details = %v, want RequestInfo", details)
+	}
+	if info, ok := details[0].(*errdetails.RequestInfo); !ok || info.RequestId != "42" {
+		t.Errorf("details = %v, want request ID 42", details)
+	}
+	if hooked != "42" {
+		t.Errorf("hook got ID %q, want 42", hooked)
+	}
+}
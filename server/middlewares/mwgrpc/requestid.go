@@ -0,0 +1,59 @@
+package mwgrpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/ra9form/yuki/server/log"
+	"github.com/ra9form/yuki/transport/requestid"
+)
+
+// UnaryRequestID takes the request ID from the x-request-id metadata or
+// generates a new one if it is missing or invalid (see requestid.Valid),
+// and sends it back in the response header.
+// The ID is stored in the context (see requestid.FromContext), its log
+// fields and the incoming metadata.
+// The ID set by mwhttp.RequestID is used for the HTTP-transcoded calls.
+func UnaryRequestID() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(withRequestID(ctx), req)
+	}
+}
+
+// StreamRequestID is UnaryRequestID for the streaming calls.
+func StreamRequestID() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &ctxStream{ServerStream: stream, ctx: withRequestID(stream.Context())})
+	}
+}
+
+func withRequestID(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	id, echoed := requestid.FromContext(ctx)
+	if !echoed {
+		if vv := md.Get(requestid.MDKey); len(vv) > 0 && requestid.Valid(vv[0]) {
+			id = vv[0]
+		} else {
+			id = requestid.New()
+		}
+		grpc.SetHeader(ctx, metadata.Pairs(requestid.MDKey, id))
+		ctx = requestid.NewContext(ctx, id)
+		ctx = log.WithFields(ctx, log.F("request_id", id))
+	}
+
+	md = md.Copy()
+	md.Set(requestid.MDKey, id)
+	return metadata.NewIncomingContext(ctx, md)
+}
+
+// ctxStream replaces the stream's context.
+type ctxStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *ctxStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,52 @@
+package mwgrpc
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/ra9form/yuki/server/log"
+	"github.com/ra9form/yuki/transport/requestid"
+)
+
+func TestUnaryRequestID(t *testing.T) {
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want string
+	}{
+		{"generated", context.Background(), ""},
+		{"metadata", metadata.NewIncomingContext(context.Background(), metadata.Pairs(requestid.MDKey, "42")), "42"},
+		{"http", requestid.NewContext(context.Background(), "43"), "43"},
+		{"invalid", metadata.NewIncomingContext(context.Background(), metadata.Pairs(requestid.MDKey, "4 2\n")), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ctx context.Context
+			_, err := UnaryRequestID()(tt.ctx, nil, &grpc.UnaryServerInfo{}, func(c context.Context, _ interface{}) (interface{}, error) {
+				ctx = c
+				return nil, nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			id, ok := requestid.FromContext(ctx)
+			if !ok || (tt.want != "" && id != tt.want) || !requestid.Valid(id) {
+				t.Fatalf("FromContext() = %q, %v, want %q", id, ok, tt.want)
+			}
+			md, _ := metadata.FromIncomingContext(ctx)
+			if got := md.Get(requestid.MDKey); len(got) != 1 || got[0] != id {
+				t.Errorf("metadata = %v, want [%v]", got, id)
+			}
+			if tt.name != "http" {
+				fields := log.FieldsFromContext(ctx)
+				if len(fields) != 1 || fields[0].Value != id {
+					t.Errorf("log fields = %v, want request_id=%v", fields, id)
+				}
+			}
+		})
+	}
+}
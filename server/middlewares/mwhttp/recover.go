@@ -1,33 +1,41 @@
 package mwhttp
 
 import (
-	"fmt"
 	"net/http"
 	"runtime/debug"
 
-	"github.com/pkg/errors"
-
 	"github.com/ra9form/yuki/server/middlewares/mwcommon"
 	"github.com/ra9form/yuki/transport/httpruntime"
 )
 
 // Recover recovers HTTP server from handlers' panics.
-func Recover(logger interface{}) Middleware {
-	logFunc := mwcommon.GetLogFunc(logger)
+// The panic and its stack are logged, the client gets a generic
+// Internal error with a correlation ID (see mwcommon.Recovered).
+// The error is written by httpruntime.SetError unless WithErrorWriter
+// is passed.
+func Recover(logger interface{}, opts ...mwcommon.RecoverOption) Middleware {
+	l, o := mwcommon.GetLogger(logger), mwcommon.NewRecoverOpts(opts...)
+	setError := o.ErrorWriter
+	if setError == nil {
+		setError = httpruntime.SetError
+	}
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			defer func() {
 				if rec := recover(); rec != nil {
-					stack := string(debug.Stack())
-					httpruntime.SetError(
-						r.Context(),
-						r, w,
-						errors.Errorf("recovered from panic: %v\nstack:%v", rec, stack),
-					)
-					logFunc(r.Context(), fmt.Sprintf("recovered from panic: %v, %v ", rec, stack))
+					err := mwcommon.Recovered(r.Context(), l, o, rec, debug.Stack())
+					setError(r.Context(), r, w, err)
 				}
 			}()
 			next.ServeHTTP(w, r)
 		})
 	}
 }
+
+// WithErrorWriter makes Recover write the errors by w, e.g. the one
+// the service's errors are written by (see transport.WithErrorWriter).
+func WithErrorWriter(w httpruntime.ErrorWriter) mwcommon.RecoverOption {
+	return func(o *mwcommon.RecoverOpts) {
+		o.ErrorWriter = w
+	}
+}
@@ -0,0 +1,65 @@
+package mwhttp
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/ra9form/yuki/server/log"
+	"github.com/ra9form/yuki/server/middlewares/mwcommon"
+	"github.com/ra9form/yuki/transport/requestid"
+)
+
+func TestRecover(t *testing.T) {
+	var hooked string
+	hook := func(_ context.Context, id string, rec interface{}, stack []byte) {
+		hooked = id
+		if rec != "secret" || len(stack) == 0 {
+			t.Errorf("hook got %v, %d bytes of stack", rec, len(stack))
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r = r.WithContext(requestid.NewContext(r.Context(), "42"))
+	w := httptest.NewRecorder()
+	Recover(log.NewJSONLogger(ioutil.Discard), mwcommon.WithPanicHook(hook))(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("secret")
+	})).ServeHTTP(w, r)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("code = %v, want 500", w.Code)
+	}
+	body := w.Body.String()
+	if strings.Contains(body, "secret") || strings.Contains(body, "goroutine") {
+		t.Errorf("body %q leaks the panic", body)
+	}
+	if !strings.Contains(body, "42") {
+		t.Errorf("body %q lacks the correlation ID", body)
+	}
+	if hooked != "42" {
+		t.Errorf("hook got ID %q, want 42", hooked)
+	}
+}
+
+func TestRecover_errorWriter(t *testing.T) {
+	var written error
+	setError := func(_ context.Context, _ *http.Request, w http.ResponseWriter, err error) {
+		written = err
+		w.WriteHeader(http.StatusTeapot)
+	}
+
+	w := httptest.NewRecorder()
+	Recover(log.NewJSONLogger(ioutil.Discard), WithErrorWriter(setError))(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("secret")
+	})).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if w.Code != http.StatusTeapot || status.Code(written) != codes.Internal {
+		t.Errorf("error writer got %v, code = %v, want Internal written by it", written, w.Code)
+	}
+}
@@ -0,0 +1,31 @@
+package mwhttp
+
+import (
+	"net/http"
+
+	"github.com/ra9form/yuki/server/log"
+	"github.com/ra9form/yuki/transport/requestid"
+)
+
+// RequestID takes the request ID from the X-Request-Id header or
+// generates a new one if it is missing or invalid (see requestid.Valid),
+// and echoes it in the response header.
+// The ID is stored in the context (see requestid.FromContext) and its log
+// fields, and in the request header, so it reaches the incoming
+// gRPC metadata of the transcoded calls.
+func RequestID() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(requestid.Header)
+			if !requestid.Valid(id) {
+				id = requestid.New()
+				r.Header.Set(requestid.Header, id)
+			}
+			w.Header().Set(requestid.Header, id)
+
+			ctx := requestid.NewContext(r.Context(), id)
+			ctx = log.WithFields(ctx, log.F("request_id", id))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package mwhttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ra9form/yuki/server/log"
+	"github.com/ra9form/yuki/transport/requestid"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{"generated", "", ""},
+		{"client", "42", "42"},
+		{"too long", strings.Repeat("4", requestid.MaxLen+1), ""},
+		{"invalid", "4 2", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.header != "" {
+				r.Header.Set(requestid.Header, tt.header)
+			}
+
+			var got *http.Request
+			w := httptest.NewRecorder()
+			RequestID()(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got = r
+			})).ServeHTTP(w, r)
+
+			id, ok := requestid.FromContext(got.Context())
+			if !ok || !requestid.Valid(id) || (tt.want != "" && id != tt.want) {
+				t.Fatalf("FromContext() = %q, %v, want %q", id, ok, tt.want)
+			}
+			if h := got.Header.Get(requestid.Header); h != id {
+				t.Errorf("request header = %q, want %q", h, id)
+			}
+			if h := w.Header().Get(requestid.Header); h != id {
+				t.Errorf("response header = %q, want %q", h, id)
+			}
+			fields := log.FieldsFromContext(got.Context())
+			if len(fields) != 1 || fields[0].Value != id {
+				t.Errorf("log fields = %v, want request_id=%v", fields, id)
+			}
+		})
+	}
+}
@@ -0,0 +1,2 @@
+/*Package mwmetrics provides Prometheus metrics for gRPC and HTTP-transcoded calls.*/
+package mwmetrics
@@ -0,0 +1,170 @@
+package mwmetrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/ra9form/yuki/transport/httptransport"
+)
+
+// Transport label values.
+const (
+	TransportGRPC = "grpc"
+	TransportHTTP = "http"
+)
+
+// Metrics records request counts, latencies and in-flight calls.
+// Every metric is labelled by the full RPC method, the transport
+// (grpc or http) and the HTTP binding pattern; the counter and
+// histogram are labelled by the resulting gRPC code as well.
+//
+// Since the generated HTTP handlers call the service through the unary
+// interceptor, the same interceptor records both gRPC and HTTP calls.
+// HTTP requests rejected before the interceptor (unknown paths,
+// unparseable bodies) are not recorded.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	inFlight *prometheus.GaugeVec
+}
+
+type options struct {
+	namespace string
+	buckets   []float64
+	registry  *prometheus.Registry
+}
+
+// Option configures the Metrics.
+type Option func(*options)
+
+// WithNamespace sets the namespace prefixing the metrics' names.
+func WithNamespace(ns string) Option {
+	return func(o *options) {
+		o.namespace = ns
+	}
+}
+
+// WithBuckets sets the buckets of the latency histogram, in seconds.
+// prometheus.DefBuckets are used by default.
+func WithBuckets(buckets ...float64) Option {
+	return func(o *options) {
+		o.buckets = buckets
+	}
+}
+
+// WithRegistry registers the metrics at the registry.
+// By default, a new registry is created with the Go runtime and process
+// collectors registered.
+func WithRegistry(r *prometheus.Registry) Option {
+	return func(o *options) {
+		o.registry = r
+	}
+}
+
+// New creates and registers the metrics.
+// It panics if the metrics are registered at the registry already.
+func New(opts ...Option) *Metrics {
+	o := &options{buckets: prometheus.DefBuckets}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.registry == nil {
+		o.registry = prometheus.NewRegistry()
+		o.registry.MustRegister(
+			prometheus.NewGoCollector(),
+			prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		)
+	}
+
+	m := &Metrics{
+		registry: o.registry,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: o.namespace,
+			Subsystem: "rpc_server",
+			Name:      "requests_total",
+			Help:      "Total number of the RPC calls handled by the server.",
+		}, []string{"method", "transport", "binding", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: o.namespace,
+			Subsystem: "rpc_server",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of the RPC calls handled by the server.",
+			Buckets:   o.buckets,
+		}, []string{"method", "transport", "binding", "code"}),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: o.namespace,
+			Subsystem: "rpc_server",
+			Name:      "requests_in_flight",
+			Help:      "Number of the RPC calls being handled by the server.",
+		}, []string{"method", "transport", "binding"}),
+	}
+	m.registry.MustRegister(m.requests, m.duration, m.inFlight)
+	return m
+}
+
+// Registry returns the registry the metrics are registered at.
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+// Handler returns the HTTP handler exposing the registry's metrics
+// to Prometheus.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// UnaryServerInterceptor records the unary calls, both received via
+// gRPC and transcoded from HTTP.
+// Panicking calls are recorded with the Internal code, the panic is
+// passed on to the recovery middlewares.
+func (m *Metrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (rsp interface{}, err error) {
+		done := m.start(ctx, info.FullMethod)
+		defer func() { done(err, recover()) }()
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor records the streaming calls.
+func (m *Metrics) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		done := m.start(stream.Context(), info.FullMethod)
+		defer func() { done(err, recover()) }()
+		return handler(srv, stream)
+	}
+}
+
+// start records the call's start and returns the func recording its end.
+// The func re-panics with rec if it is not nil.
+func (m *Metrics) start(ctx context.Context, method string) func(err error, rec interface{}) {
+	transport, binding := TransportGRPC, ""
+	if b, ok := httptransport.BindingFromContext(ctx); ok {
+		transport, binding = TransportHTTP, b.String()
+	}
+
+	inFlight := m.inFlight.WithLabelValues(method, transport, binding)
+	inFlight.Inc()
+	start := time.Now()
+
+	return func(err error, rec interface{}) {
+		inFlight.Dec()
+		code := status.Code(err)
+		if rec != nil {
+			code = codes.Internal
+		}
+		m.requests.WithLabelValues(method, transport, binding, code.String()).Inc()
+		m.duration.WithLabelValues(method, transport, binding, code.String()).Observe(time.Since(start).Seconds())
+		if rec != nil {
+			panic(rec)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package mwmetrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/ra9form/yuki/transport/httptransport"
+)
+
+func TestMetrics_UnaryServerInterceptor(t *testing.T) {
+	m := New()
+	i := m.UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/strings.Strings/ToUpper"}
+
+	ok := func(context.Context, interface{}) (interface{}, error) { return "ok", nil }
+	fail := func(context.Context, interface{}) (interface{}, error) {
+		return nil, status.Error(codes.NotFound, "not found")
+	}
+
+	httpCtx := httptransport.NewBindingContext(context.Background(), httptransport.Binding{
+		Method:  "GET",
+		Pattern: "/strings/{str}",
+	})
+	i(context.Background(), nil, info, ok)
+	i(httpCtx, nil, info, ok)
+	i(httpCtx, nil, info, fail)
+
+	tests := []struct {
+		transport, binding, code string
+		want                     float64
+	}{
+		{TransportGRPC, "", "OK", 1},
+		{TransportHTTP, "GET /strings/{str}", "OK", 1},
+		{TransportHTTP, "GET /strings/{str}", "NotFound", 1},
+		{TransportGRPC, "", "NotFound", 0},
+	}
+	for _, tc := range tests {
+		c := m.requests.WithLabelValues(info.FullMethod, tc.transport, tc.binding, tc.code)
+		if got := testutil.ToFloat64(c); got != tc.want {
+			t.Errorf("requests{%v,%q,%v} = %v, want %v", tc.transport, tc.binding, tc.code, got, tc.want)
+		}
+	}
+	if got := testutil.ToFloat64(m.inFlight.WithLabelValues(info.FullMethod, TransportHTTP, "GET /strings/{str}")); got != 0 {
+		t.Errorf("requests in flight = %v, want 0", got)
+	}
+}
+
+func TestMetrics_UnaryServerInterceptorPanic(t *testing.T) {
+	m := New()
+	i := m.UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/strings.Strings/ToUpper"}
+
+	func() {
+		defer func() {
+			if rec := recover(); rec != "boom" {
+				t.Errorf("recovered %v, want the handler's panic", rec)
+			}
+		}()
+		i(context.Background(), nil, info, func(context.Context, interface{}) (interface{}, error) {
+			panic("boom")
+		})
+	}()
+
+	if got := testutil.ToFloat64(m.inFlight.WithLabelValues(info.FullMethod, TransportGRPC, "")); got != 0 {
+		t.Errorf("requests in flight = %v, want 0", got)
+	}
+	if got := testutil.ToFloat64(m.requests.WithLabelValues(info.FullMethod, TransportGRPC, "", "Internal")); got != 1 {
+		t.Errorf("requests{Internal} = %v, want 1", got)
+	}
+}
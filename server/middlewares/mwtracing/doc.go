@@ -0,0 +1,2 @@
+/*Package mwtracing provides gRPC middlewares tracing the calls with transport/tracing.*/
+package mwtracing
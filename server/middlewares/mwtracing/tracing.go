@@ -0,0 +1,97 @@
+package mwtracing
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/ra9form/yuki/transport/httptransport"
+	"github.com/ra9form/yuki/transport/tracing"
+)
+
+// Span attributes set by the middlewares.
+const (
+	AttrRPCSystem = "rpc.system"
+	// AttrTransport is grpc or http.
+	AttrTransport = "rpc.transport"
+	// AttrHTTPRoute is the HTTP binding, set for HTTP calls only.
+	AttrHTTPRoute = "http.route"
+)
+
+// UnaryServerInterceptor starts a server span per call, named after the
+// gRPC full method.
+// Panicking calls end their spans with the Internal status.
+// The remote parent is taken from the traceparent metadata; HTTP headers
+// reach it as metadata as well, so the calls received via the JSON
+// bindings are traced the same way.
+func UnaryServerInterceptor(t *tracing.Tracer) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (rsp interface{}, err error) {
+		ctx, span := startServerSpan(ctx, t, info.FullMethod)
+		defer func() { endSpan(span, err, recover()) }()
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor starts a server span per streaming call.
+func StreamServerInterceptor(t *tracing.Tracer) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		ctx, span := startServerSpan(stream.Context(), t, info.FullMethod)
+		defer func() { endSpan(span, err, recover()) }()
+		return handler(srv, &tracedStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+// UnaryClientInterceptor propagates the context's span to the outgoing
+// gRPC calls.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(tracing.InjectOutgoingMD(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+func startServerSpan(ctx context.Context, t *tracing.Tracer, method string) (context.Context, *tracing.Span) {
+	var remote tracing.SpanContext
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		remote, _ = tracing.ExtractMD(md)
+	}
+
+	ctx, span := t.Start(ctx, method, tracing.SpanKindServer, remote)
+	span.SetAttribute(AttrRPCSystem, "grpc")
+	if b, ok := httptransport.BindingFromContext(ctx); ok {
+		span.SetAttribute(AttrTransport, "http")
+		span.SetAttribute(AttrHTTPRoute, b.String())
+	} else {
+		span.SetAttribute(AttrTransport, "grpc")
+	}
+	return ctx, span
+}
+
+// endSpan ends the span with the call's status.
+// A panic is recorded as Internal and re-panicked with rec.
+func endSpan(span *tracing.Span, err error, rec interface{}) {
+	switch {
+	case rec != nil:
+		span.SetStatus(codes.Internal, fmt.Sprintf("panic: %v", rec))
+	case err != nil:
+		st := status.Convert(err)
+		span.SetStatus(st.Code(), st.Message())
+	}
+	span.End()
+	if rec != nil {
+		panic(rec)
+	}
+}
+
+// tracedStream replaces the stream's context with the one carrying the span.
+type tracedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tracedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,79 @@
+package mwtracing
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/ra9form/yuki/transport/httptransport"
+	"github.com/ra9form/yuki/transport/tracing"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	exp := tracing.NewInMemoryExporter()
+	i := UnaryServerInterceptor(tracing.NewTracer(exp))
+	info := &grpc.UnaryServerInfo{FullMethod: "/strings.Strings/ToUpper"}
+
+	const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("traceparent", parent))
+	ctx = httptransport.NewBindingContext(ctx, httptransport.Binding{Method: "POST", Pattern: "/strings/to_upper"})
+
+	var inner *tracing.Span
+	i(ctx, nil, info, func(ctx context.Context, _ interface{}) (interface{}, error) {
+		inner = tracing.SpanFromContext(ctx)
+		return nil, status.Error(codes.NotFound, "nope")
+	})
+
+	spans := exp.Spans()
+	if len(spans) != 1 {
+		t.Fatalf("got %v spans, want 1", len(spans))
+	}
+	s := spans[0]
+	if s.Name != info.FullMethod {
+		t.Errorf("Name = %q, want %q", s.Name, info.FullMethod)
+	}
+	if got := s.Parent.Traceparent(); got != parent {
+		t.Errorf("Parent = %q, want %q", got, parent)
+	}
+	if s.SpanContext.TraceID != s.Parent.TraceID {
+		t.Error("span doesn't continue the remote trace")
+	}
+	if inner == nil || inner.SpanContext() != s.SpanContext {
+		t.Error("span isn't passed to the handler")
+	}
+	if s.Attributes[AttrTransport] != "http" || s.Attributes[AttrHTTPRoute] != "POST /strings/to_upper" {
+		t.Errorf("Attributes = %v, want http transport and route", s.Attributes)
+	}
+	if s.Code != codes.NotFound {
+		t.Errorf("Code = %v, want NotFound", s.Code)
+	}
+}
+
+func TestUnaryServerInterceptorPanic(t *testing.T) {
+	exp := tracing.NewInMemoryExporter()
+	i := UnaryServerInterceptor(tracing.NewTracer(exp))
+	info := &grpc.UnaryServerInfo{FullMethod: "/strings.Strings/ToUpper"}
+
+	func() {
+		defer func() {
+			if rec := recover(); rec != "boom" {
+				t.Errorf("recovered %v, want the handler's panic", rec)
+			}
+		}()
+		i(context.Background(), nil, info, func(context.Context, interface{}) (interface{}, error) {
+			panic("boom")
+		})
+	}()
+
+	spans := exp.Spans()
+	if len(spans) != 1 {
+		t.Fatalf("got %v spans, want 1", len(spans))
+	}
+	if s := spans[0]; s.Code != codes.Internal || s.StatusMessage != "panic: boom" {
+		t.Errorf("status = %v %q, want Internal panic: boom", s.Code, s.StatusMessage)
+	}
+}
@@ -1,14 +1,27 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
+	stdlog "log"
+	"net"
 	"net/http"
+	"os"
+	"syscall"
+	"time"
 
 	"github.com/go-chi/chi"
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
 
+	"github.com/ra9form/yuki/server/log"
 	"github.com/ra9form/yuki/server/middlewares/mwhttp"
+	"github.com/ra9form/yuki/server/middlewares/mwmetrics"
+	"github.com/ra9form/yuki/server/middlewares/mwtracing"
 	"github.com/ra9form/yuki/transport"
+	"github.com/ra9form/yuki/transport/httpruntime"
+	"github.com/ra9form/yuki/transport/tracing"
 )
 
 // Option is an optional setting applied to the Server.
@@ -20,17 +33,282 @@ type serverOpts struct {
 	HTTPPort int
 	HTTPMux  transport.Router
 
+	// AdminPort is the port for the operational endpoints,
+	// used only if AdminEnabled is set.
+	AdminPort    int
+	AdminEnabled bool
+
+	// Listeners to use instead of listening on the ports.
+	RPCListener   net.Listener
+	HTTPListener  net.Listener
+	AdminListener net.Listener
+
+	// ListenRetry is the policy for the ports already in use.
+	ListenRetry ListenRetry
+	// InheritListeners makes the server use the listeners passed by
+	// systemd or by the process that started it via Upgrade.
+	InheritListeners bool
+
 	HTTPMiddlewares []func(http.Handler) http.Handler
 
-	GRPCOpts             []grpc.ServerOption
-	GRPCUnaryInterceptor grpc.UnaryServerInterceptor
+	// Settings of the http.Server, see its fields.
+	HTTPReadTimeout       time.Duration
+	HTTPReadHeaderTimeout time.Duration
+	HTTPWriteTimeout      time.Duration
+	HTTPIdleTimeout       time.Duration
+	HTTPMaxHeaderBytes    int
+	HTTPConnState         func(net.Conn, http.ConnState)
+	HTTPErrorLog          *stdlog.Logger // nil to use the Logger
+
+	// TLS settings for the public listeners.
+	// TLS is terminated before the protocol detection.
+	TLSConfig       *tls.Config
+	TLSCertFile     string
+	TLSKeyFile      string
+	TLSClientCAFile string
+	TLSClientAuth   tls.ClientAuthType
+
+	// ProxyProtocol enables PROXY protocol on the public listeners,
+	// accepting the headers from ProxyTrustedCIDRs.
+	ProxyProtocol     bool
+	ProxyTrustedCIDRs []string
+
+	// Reflection enables gRPC server reflection and the descriptors
+	// HTTP endpoint.
+	Reflection bool
+
+	// Marshalers is the registry of the HTTP handlers, unless
+	// the ServiceDesc has its own.
+	Marshalers *httpruntime.MarshalerRegistry
+
+	GRPCOpts []grpc.ServerOption
+	// Interceptors are chained in the order they were added.
+	// Unary ones are applied to the HTTP-transcoded calls as well.
+	GRPCUnaryInterceptors  []grpc.UnaryServerInterceptor
+	GRPCStreamInterceptors []grpc.StreamServerInterceptor
+
+	// Metrics records the calls if set, it's served at the admin /metrics.
+	Metrics *mwmetrics.Metrics
+	// Tracer traces the calls if set.
+	Tracer *tracing.Tracer
+
+	// ShutdownTimeout limits the time Stop waits for in-flight calls.
+	ShutdownTimeout time.Duration
+	// ShutdownDelay is the time between reporting NOT_SERVING and
+	// closing the listeners.
+	ShutdownDelay time.Duration
+	// ShutdownSignals make RunContext stop the server once received.
+	ShutdownSignals []os.Signal
+	// UpgradeSignals make RunContext call Upgrade once received.
+	UpgradeSignals []os.Signal
+	// UpgradeTimeout limits the time RunContext waits for the new process
+	// to become ready on upgrade.
+	UpgradeTimeout time.Duration
+
+	OnStart []Hook
+	OnStop  []Hook
+
+	// Logger receives the server's own messages.
+	Logger log.Logger
 }
 
+// Hook is called on the Server's lifecycle events.
+type Hook func(context.Context) error
+
+const (
+	defaultShutdownTimeout       = 30 * time.Second
+	defaultUpgradeTimeout        = time.Minute
+	defaultHTTPReadHeaderTimeout = 10 * time.Second
+	defaultHTTPIdleTimeout       = 2 * time.Minute
+)
+
 func defaultServerOpts(mainPort int) *serverOpts {
 	return &serverOpts{
-		RPCPort:  mainPort,
-		HTTPPort: mainPort,
-		HTTPMux:  chi.NewMux(),
+		RPCPort:         mainPort,
+		HTTPPort:        mainPort,
+		HTTPMux:         chi.NewMux(),
+		ShutdownTimeout: defaultShutdownTimeout,
+		UpgradeTimeout:  defaultUpgradeTimeout,
+
+		HTTPReadHeaderTimeout: defaultHTTPReadHeaderTimeout,
+		HTTPIdleTimeout:       defaultHTTPIdleTimeout,
+		Logger:                log.DefaultLogger,
+	}
+}
+
+// newHTTPServer creates http.Server configured by the options.
+func (o *serverOpts) newHTTPServer(h http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           h,
+		ReadTimeout:       o.HTTPReadTimeout,
+		ReadHeaderTimeout: o.HTTPReadHeaderTimeout,
+		WriteTimeout:      o.HTTPWriteTimeout,
+		IdleTimeout:       o.HTTPIdleTimeout,
+		MaxHeaderBytes:    o.HTTPMaxHeaderBytes,
+		ConnState:         o.HTTPConnState,
+		ErrorLog:          o.httpErrorLog(),
+	}
+}
+
+// newAdminServer creates http.Server for the admin endpoints.
+// Only the header read and idle timeouts apply, the pprof profile and
+// trace endpoints write the response for as long as requested.
+func (o *serverOpts) newAdminServer(h http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           h,
+		ReadHeaderTimeout: o.HTTPReadHeaderTimeout,
+		IdleTimeout:       o.HTTPIdleTimeout,
+		ErrorLog:          o.httpErrorLog(),
+	}
+}
+
+func (o *serverOpts) httpErrorLog() *stdlog.Logger {
+	if o.HTTPErrorLog != nil {
+		return o.HTTPErrorLog
+	}
+	return log.StdLogger(o.Logger, log.LevelError)
+}
+
+// WithLogger sets the logger for the server's own messages and
+// the HTTP server errors.
+// By default, log.DefaultLogger is used.
+func WithLogger(l log.Logger) Option {
+	return func(o *serverOpts) {
+		o.Logger = l
+	}
+}
+
+// WithShutdownTimeout sets the time Stop waits for in-flight HTTP requests
+// and gRPC calls to finish before closing their connections forcibly.
+func WithShutdownTimeout(d time.Duration) Option {
+	return func(o *serverOpts) {
+		o.ShutdownTimeout = d
+	}
+}
+
+// WithShutdownDelay makes Shutdown keep accepting new connections for
+// the duration after the health service starts reporting NOT_SERVING,
+// giving the load balancers time to stop routing calls to the server.
+// The delay is a part of the ShutdownTimeout.
+func WithShutdownDelay(d time.Duration) Option {
+	return func(o *serverOpts) {
+		o.ShutdownDelay = d
+	}
+}
+
+// WithShutdownSignals makes the server shut down gracefully
+// when any of the signals is received.
+// SIGINT and SIGTERM are used if no signals are passed.
+func WithShutdownSignals(sigs ...os.Signal) Option {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	return func(o *serverOpts) {
+		o.ShutdownSignals = sigs
+	}
+}
+
+// WithUpgradeSignals makes the server hand its listeners over to a new
+// process of the executable when any of the signals is received, see
+// Server.Upgrade. The server keeps running if the upgrade fails.
+// SIGHUP is used if no signals are passed.
+func WithUpgradeSignals(sigs ...os.Signal) Option {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGHUP}
+	}
+	return func(o *serverOpts) {
+		o.UpgradeSignals = sigs
+	}
+}
+
+// WithUpgradeTimeout sets the time the server waits for the new process
+// to become ready when upgrading on the UpgradeSignals. The new process
+// is killed and the server keeps running if it isn't ready in time.
+// It's one minute by default.
+func WithUpgradeTimeout(d time.Duration) Option {
+	return func(o *serverOpts) {
+		o.UpgradeTimeout = d
+	}
+}
+
+// WithOnStart adds hooks that are called after the listeners are bound,
+// but before the requests are served.
+// They receive the context passed to RunContext.
+// If any of them fails, the server is not started and Run returns the error.
+func WithOnStart(hooks ...Hook) Option {
+	return func(o *serverOpts) {
+		o.OnStart = append(o.OnStart, hooks...)
+	}
+}
+
+// WithOnStop adds hooks that are called after the server has been drained.
+// They receive the context passed to Shutdown.
+func WithOnStop(hooks ...Hook) Option {
+	return func(o *serverOpts) {
+		o.OnStop = append(o.OnStop, hooks...)
+	}
+}
+
+// WithProxyProtocol makes the public listeners read HAProxy PROXY
+// protocol (v1 or v2) headers sent by load balancers, so the calls
+// report the real client's address as http.Request.RemoteAddr and
+// in the gRPC peer.Peer.
+// Headers are accepted only from the connections coming from the trusted
+// networks (in CIDR notation, e.g. "10.0.0.0/8"); other connections are
+// served as is. At least one network is required, pass "0.0.0.0/0" and
+// "::/0" to trust any source.
+// The trusted sources must send the header, their connections are
+// closed otherwise.
+func WithProxyProtocol(trustedCIDRs ...string) Option {
+	return func(o *serverOpts) {
+		o.ProxyProtocol = true
+		o.ProxyTrustedCIDRs = trustedCIDRs
+	}
+}
+
+// WithHTTPTimeouts sets timeouts of the HTTP server.
+// Zero value means no timeout, except for the readHeader which defaults to
+// the read timeout, see http.Server.
+// By default, readHeader is 10s and idle is 2m.
+func WithHTTPTimeouts(read, readHeader, write, idle time.Duration) Option {
+	return func(o *serverOpts) {
+		o.HTTPReadTimeout = read
+		o.HTTPReadHeaderTimeout = readHeader
+		o.HTTPWriteTimeout = write
+		o.HTTPIdleTimeout = idle
+	}
+}
+
+// WithHTTPMaxHeaderBytes limits the size of HTTP request headers.
+func WithHTTPMaxHeaderBytes(n int) Option {
+	return func(o *serverOpts) {
+		o.HTTPMaxHeaderBytes = n
+	}
+}
+
+// WithHTTPConnState sets the hook called when HTTP connections change state.
+func WithHTTPConnState(f func(net.Conn, http.ConnState)) Option {
+	return func(o *serverOpts) {
+		o.HTTPConnState = f
+	}
+}
+
+// WithHTTPErrorLog sets the logger for the HTTP server errors.
+// By default, errors are written to the server's Logger.
+func WithHTTPErrorLog(l *stdlog.Logger) Option {
+	return func(o *serverOpts) {
+		o.HTTPErrorLog = l
+	}
+}
+
+// WithGRPCKeepalive sets keepalive parameters and enforcement policy
+// for the gRPC server.
+func WithGRPCKeepalive(params keepalive.ServerParameters, policy keepalive.EnforcementPolicy) Option {
+	return func(o *serverOpts) {
+		o.GRPCOpts = append(o.GRPCOpts,
+			grpc.KeepaliveParams(params),
+			grpc.KeepaliveEnforcementPolicy(policy),
+		)
 	}
 }
 
@@ -49,6 +327,100 @@ func WithHTTPPort(port int) Option {
 	}
 }
 
+// WithAdminPort enables the admin HTTP server on a separate port.
+// It serves health and readiness probes, pprof, Swagger definition,
+// build info and the list of registered routes.
+// The Swagger definition and the probes (/healthz and /readyz) are
+// served on the public port unless the admin server is enabled.
+// Read and write timeouts of WithHTTPTimeouts don't apply to the admin server.
+func WithAdminPort(port int) Option {
+	return func(o *serverOpts) {
+		o.AdminPort = port
+		o.AdminEnabled = true
+	}
+}
+
+// WithTLS serves both gRPC and HTTP over TLS using the certificate
+// and key files.
+// The files are reloaded when they change on disk.
+func WithTLS(certFile, keyFile string) Option {
+	return func(o *serverOpts) {
+		o.TLSCertFile = certFile
+		o.TLSKeyFile = keyFile
+	}
+}
+
+// WithTLSConfig serves both gRPC and HTTP over TLS using the config.
+// It can be combined with WithTLS, which then provides the certificate.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(o *serverOpts) {
+		o.TLSConfig = cfg
+	}
+}
+
+// WithTLSClientAuth enables client certificates' verification against
+// CAs from the PEM file.
+// The caFile may be empty if WithTLSConfig provides the ClientCAs.
+// Run fails if TLS is not enabled or the verification has no CAs.
+func WithTLSClientAuth(caFile string, auth tls.ClientAuthType) Option {
+	return func(o *serverOpts) {
+		o.TLSClientCAFile = caFile
+		o.TLSClientAuth = auth
+	}
+}
+
+// WithListener sets the main listener to use instead of listening on
+// the rpcPort, e.g. a Unix domain socket or an in-memory bufconn.
+// HTTP requests are served on it as well unless WithHTTPListener or
+// WithHTTPPort is used.
+// The listener is closed when the server stops.
+func WithListener(l net.Listener) Option {
+	return func(o *serverOpts) {
+		o.RPCListener = l
+	}
+}
+
+// WithHTTPListener sets a separate listener for the HTTP requests.
+// The listener is closed when the server stops.
+func WithHTTPListener(l net.Listener) Option {
+	return func(o *serverOpts) {
+		o.HTTPListener = l
+	}
+}
+
+// WithAdminListener enables the admin HTTP server on the listener,
+// see WithAdminPort.
+// The listener is closed when the server stops.
+func WithAdminListener(l net.Listener) Option {
+	return func(o *serverOpts) {
+		o.AdminListener = l
+		o.AdminEnabled = true
+	}
+}
+
+// WithListenRetry makes the server retry to listen on the ports that
+// are already in use, pausing for wait between attempts until timeout
+// passes.
+// By default, the server fails immediately.
+func WithListenRetry(wait, timeout time.Duration) Option {
+	return func(o *serverOpts) {
+		o.ListenRetry = ListenRetry{Wait: wait, Timeout: timeout}
+	}
+}
+
+// WithInheritedListeners makes the server use the listeners passed
+// in LISTEN_FDS environment, either by systemd socket activation or
+// by the process that started it via Server.Upgrade.
+// The listeners are matched by LISTEN_FDNAMES: "grpc" is the main
+// listener, "http" and "admin" are used as WithHTTPListener and
+// WithAdminListener. Unnamed listeners are taken in that order.
+// The server listens on the ports if a listener isn't passed.
+func WithInheritedListeners() Option {
+	return func(o *serverOpts) {
+		o.InheritListeners = true
+	}
+}
+
 // WithHTTPMiddlewares sets up HTTP middlewares to work with.
 func WithHTTPMiddlewares(mws ...mwhttp.Middleware) Option {
 	mwGeneric := make([]func(http.Handler) http.Handler, 0, len(mws))
@@ -60,20 +432,105 @@ func WithHTTPMiddlewares(mws ...mwhttp.Middleware) Option {
 	}
 }
 
+// WithReflection registers the gRPC server reflection service, so tools
+// like grpcurl can introspect the server.
+// The FileDescriptorSet of the registered services is served over HTTP
+// at /api/descriptors as well, in the media type negotiated by
+// the marshalers (see WithMarshalers), JSON by default.
+func WithReflection() Option {
+	return func(o *serverOpts) {
+		o.Reflection = true
+	}
+}
+
+// WithMarshalers sets up the registry the HTTP handlers look
+// the marshalers up in.
+// The registry set by transport.WithMarshalers on the ServiceDesc
+// takes precedence. httpruntime.DefaultRegistry is used by default.
+func WithMarshalers(r *httpruntime.MarshalerRegistry) Option {
+	return func(o *serverOpts) {
+		o.Marshalers = r
+	}
+}
+
 // WithGRPCUnaryMiddlewares sets up unary middlewares for gRPC server.
+// They are applied to the HTTP-transcoded calls as well.
+// Subsequent calls add the middlewares to the end of the chain.
 func WithGRPCUnaryMiddlewares(mws ...grpc.UnaryServerInterceptor) Option {
-	mw := grpc_middleware.ChainUnaryServer(mws...)
 	return func(o *serverOpts) {
-		o.GRPCOpts = append(o.GRPCOpts, grpc.UnaryInterceptor(mw))
-		o.GRPCUnaryInterceptor = mw
+		o.GRPCUnaryInterceptors = append(o.GRPCUnaryInterceptors, mws...)
 	}
 }
 
 // WithGRPCStreamMiddlewares sets up stream middlewares for gRPC server.
+// Subsequent calls add the middlewares to the end of the chain.
 func WithGRPCStreamMiddlewares(mws ...grpc.StreamServerInterceptor) Option {
 	return func(o *serverOpts) {
-		o.GRPCOpts = append(o.GRPCOpts, grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(mws...)))
+		o.GRPCStreamInterceptors = append(o.GRPCStreamInterceptors, mws...)
+	}
+}
+
+// WithMetrics records Prometheus metrics of the gRPC and HTTP-transcoded
+// calls, see mwmetrics.Metrics. The metrics are recorded before any
+// other middleware and served at the admin /metrics endpoint.
+// Metrics with the default options are used if m is nil.
+func WithMetrics(m *mwmetrics.Metrics) Option {
+	return func(o *serverOpts) {
+		if m == nil {
+			m = mwmetrics.New()
+		}
+		o.Metrics = m
+	}
+}
+
+// WithTracer starts a tracing span for every gRPC and HTTP-transcoded
+// call, continuing the trace propagated by the client via W3C Trace
+// Context headers, see mwtracing.UnaryServerInterceptor.
+// The spans are started after the metrics and before other middlewares.
+func WithTracer(t *tracing.Tracer) Option {
+	return func(o *serverOpts) {
+		o.Tracer = t
+	}
+}
+
+// unaryInterceptor returns the chain of the unary interceptors,
+// nil if there are none.
+func (o *serverOpts) unaryInterceptor() grpc.UnaryServerInterceptor {
+	var mws []grpc.UnaryServerInterceptor
+	if o.Metrics != nil {
+		mws = append(mws, o.Metrics.UnaryServerInterceptor())
+	}
+	if o.Tracer != nil {
+		mws = append(mws, mwtracing.UnaryServerInterceptor(o.Tracer))
+	}
+	mws = append(mws, o.GRPCUnaryInterceptors...)
+	switch len(mws) {
+	case 0:
+		return nil
+	case 1:
+		return mws[0]
+	}
+	return grpc_middleware.ChainUnaryServer(mws...)
+}
+
+// streamInterceptor returns the chain of the stream interceptors,
+// nil if there are none.
+func (o *serverOpts) streamInterceptor() grpc.StreamServerInterceptor {
+	var mws []grpc.StreamServerInterceptor
+	if o.Metrics != nil {
+		mws = append(mws, o.Metrics.StreamServerInterceptor())
+	}
+	if o.Tracer != nil {
+		mws = append(mws, mwtracing.StreamServerInterceptor(o.Tracer))
+	}
+	mws = append(mws, o.GRPCStreamInterceptors...)
+	switch len(mws) {
+	case 0:
+		return nil
+	case 1:
+		return mws[0]
 	}
+	return grpc_middleware.ChainStreamServer(mws...)
 }
 
 // WithHTTPMux sets existing HTTP muxer to use instead of creating new one.
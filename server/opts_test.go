@@ -0,0 +1,74 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/keepalive"
+
+	"github.com/ra9form/yuki/server/log"
+)
+
+func Test_newHTTPServer(t *testing.T) {
+	logs := &logBuffer{}
+	o := defaultServerOpts(0)
+	for _, opt := range []Option{
+		WithHTTPTimeouts(time.Second, 2*time.Second, 3*time.Second, 4*time.Second),
+		WithHTTPMaxHeaderBytes(1024),
+		WithLogger(log.NewJSONLogger(logs)),
+	} {
+		opt(o)
+	}
+
+	srv := o.newHTTPServer(nil)
+	if srv.ReadTimeout != time.Second || srv.ReadHeaderTimeout != 2*time.Second ||
+		srv.WriteTimeout != 3*time.Second || srv.IdleTimeout != 4*time.Second {
+		t.Errorf("timeouts = %v, %v, %v, %v, want 1s, 2s, 3s, 4s",
+			srv.ReadTimeout, srv.ReadHeaderTimeout, srv.WriteTimeout, srv.IdleTimeout)
+	}
+	if srv.MaxHeaderBytes != 1024 {
+		t.Errorf("MaxHeaderBytes = %v, want 1024", srv.MaxHeaderBytes)
+	}
+
+	srv.ErrorLog.Printf("http: TLS handshake error")
+	if got := logs.String(); !strings.Contains(got, `"level":"error"`) || !strings.Contains(got, "TLS handshake error") {
+		t.Errorf("HTTP server error logged as %q, want it at the error level", got)
+	}
+}
+
+func Test_newHTTPServer_defaults(t *testing.T) {
+	srv := defaultServerOpts(0).newHTTPServer(nil)
+	if srv.ReadHeaderTimeout != defaultHTTPReadHeaderTimeout || srv.IdleTimeout != defaultHTTPIdleTimeout {
+		t.Errorf("timeouts = %v, %v, want the defaults", srv.ReadHeaderTimeout, srv.IdleTimeout)
+	}
+	if srv.ErrorLog == nil {
+		t.Error("ErrorLog isn't set")
+	}
+}
+
+func TestServer_WithGRPCKeepalive(t *testing.T) {
+	o := defaultServerOpts(0)
+	WithGRPCKeepalive(
+		keepalive.ServerParameters{Time: time.Minute},
+		keepalive.EnforcementPolicy{MinTime: time.Second},
+	)(o)
+	if len(o.GRPCOpts) != 2 {
+		t.Errorf("got %v gRPC options, want keepalive params and policy", len(o.GRPCOpts))
+	}
+
+	srv := NewServer(0, WithGRPCKeepalive(keepalive.ServerParameters{}, keepalive.EnforcementPolicy{}))
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- srv.Run(testService{})
+	}()
+	select {
+	case <-srv.Ready():
+	case err := <-runErr:
+		t.Fatalf("Run() error = %v", err)
+	}
+	srv.Stop()
+	if err := <-runErr; err != nil {
+		t.Errorf("Run() error = %v", err)
+	}
+}
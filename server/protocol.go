@@ -0,0 +1,290 @@
+package server
+
+import (
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/soheilhy/cmux"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// isGRPCContentType returns true for gRPC content types:
+// application/grpc and application/grpc+<codec>.
+// gRPC-Web requests (application/grpc-web*) are left to the HTTP handlers,
+// since grpc.Server can't serve them.
+func isGRPCContentType(ct string) bool {
+	if !strings.HasPrefix(ct, "application/grpc") {
+		return false
+	}
+	switch rest := ct[len("application/grpc"):]; {
+	case rest == "":
+		return true
+	case rest[0] == '+' || rest[0] == ';':
+		return true
+	}
+	return false
+}
+
+// matchGRPC matches HTTP/2 connections carrying gRPC calls, so HTTP/2 JSON
+// clients reach the HTTP handlers.
+//
+// Some gRPC clients block until they receive the SETTINGS frame, so
+// the matcher sends it while sniffing; the client acknowledges it later.
+// grpc.Server ignores unexpected ACKs, but http2.Server treats them
+// as a protocol error, so httpListener removes the extra ACK.
+func matchGRPC() cmux.MatchWriter {
+	return func(w io.Writer, r io.Reader) bool {
+		return matchHTTP2ContentType(w, r, isGRPCContentType)
+	}
+}
+
+// sniffingListener is the listener of the cmux. It tracks the connections
+// until they are matched, since the cmux waits for the ones being matched
+// before it returns. Close closes them, so the connections which never
+// send enough to be matched don't block the shutdown.
+type sniffingListener struct {
+	net.Listener
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+}
+
+func newSniffingListener(li net.Listener) *sniffingListener {
+	return &sniffingListener{Listener: li, conns: map[net.Conn]struct{}{}}
+}
+
+func (l *sniffingListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return c, err
+	}
+	sc := &sniffedConn{Conn: c, l: l}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		c.Close()
+		return sc, nil
+	}
+	l.conns[sc] = struct{}{}
+	return sc, nil
+}
+
+// Close closes the listener and the connections being matched.
+func (l *sniffingListener) Close() error {
+	err := l.Listener.Close()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	for c := range l.conns {
+		c.(*sniffedConn).Conn.Close()
+		delete(l.conns, c)
+	}
+	return err
+}
+
+func (l *sniffingListener) untrack(c net.Conn) {
+	l.mu.Lock()
+	delete(l.conns, c)
+	l.mu.Unlock()
+}
+
+// matched returns the listener of the matched connections, they are
+// not tracked anymore.
+func (l *sniffingListener) matched(li net.Listener) net.Listener {
+	return matchedListener{Listener: li, sniffing: l}
+}
+
+type matchedListener struct {
+	net.Listener
+	sniffing *sniffingListener
+}
+
+func (l matchedListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if mc, ok := c.(*cmux.MuxConn); ok {
+		l.sniffing.untrack(mc.Conn)
+	}
+	return c, err
+}
+
+// sniffedConn is the connection accepted by sniffingListener.
+type sniffedConn struct {
+	net.Conn
+	l *sniffingListener
+}
+
+func (c *sniffedConn) Close() error {
+	c.l.untrack(c)
+	return c.Conn.Close()
+}
+
+// httpListener receives the connections not matched by matchGRPC.
+// The SETTINGS frame was sent to every HTTP/2 one of them, since
+// clients send their SETTINGS right after the preface.
+type httpListener struct {
+	net.Listener
+}
+
+func (l httpListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return c, err
+	}
+	return &settingsAckFilterConn{Conn: c}, nil
+}
+
+// matchHTTP2ContentType reads HTTP/2 frames until the request headers
+// are received and matches the content-type.
+// It sends SETTINGS frame to w as a server would do.
+// It is based on the cmux.HTTP2MatchHeaderFieldSendSettings.
+func matchHTTP2ContentType(w io.Writer, r io.Reader, match func(string) bool) (matched bool) {
+	if !hasHTTP2Preface(r) {
+		return false
+	}
+
+	done, settingsSent := false, false
+	framer := http2.NewFramer(w, r)
+	hdec := hpack.NewDecoder(uint32(4<<10), func(hf hpack.HeaderField) {
+		if hf.Name == "content-type" {
+			done = true
+			matched = match(hf.Value)
+		}
+	})
+	for {
+		f, err := framer.ReadFrame()
+		if err != nil {
+			return false
+		}
+
+		switch f := f.(type) {
+		case *http2.SettingsFrame:
+			if f.IsAck() || settingsSent {
+				break
+			}
+			if err := framer.WriteSettings(); err != nil {
+				return false
+			}
+			settingsSent = true
+		case *http2.ContinuationFrame:
+			if _, err := hdec.Write(f.HeaderBlockFragment()); err != nil {
+				return false
+			}
+			done = done || f.FrameHeader.Flags&http2.FlagContinuationEndHeaders != 0
+		case *http2.HeadersFrame:
+			if _, err := hdec.Write(f.HeaderBlockFragment()); err != nil {
+				return false
+			}
+			done = done || f.FrameHeader.Flags&http2.FlagHeadersEndHeaders != 0
+		}
+
+		if done {
+			return matched
+		}
+	}
+}
+
+// hasHTTP2Preface reads the connection until it differs from
+// the HTTP/2 client preface.
+func hasHTTP2Preface(r io.Reader) bool {
+	var b [len(http2.ClientPreface)]byte
+	last := 0
+
+	for {
+		n, err := r.Read(b[last:])
+		if err != nil {
+			return false
+		}
+
+		last += n
+		eq := string(b[:last]) == http2.ClientPreface[:last]
+		if last == len(http2.ClientPreface) {
+			return eq
+		}
+		if !eq {
+			return false
+		}
+	}
+}
+
+// http2FrameHeaderLen is the length of HTTP/2 frame header.
+const http2FrameHeaderLen = 9
+
+// settingsAckFilterConn removes the first SETTINGS ACK frame sent
+// by the HTTP/2 client. Other connections are passed through.
+type settingsAckFilterConn struct {
+	net.Conn
+
+	prefaceRead bool
+	done        bool
+	// pending is read but not yet returned to the caller.
+	pending []byte
+	// skip is the number of the current frame's payload bytes left
+	// to pass through.
+	skip int
+}
+
+func (c *settingsAckFilterConn) Read(p []byte) (int, error) {
+	for {
+		switch {
+		case len(c.pending) > 0:
+			n := copy(p, c.pending)
+			c.pending = c.pending[n:]
+			return n, nil
+		case c.skip > 0:
+			if len(p) > c.skip {
+				p = p[:c.skip]
+			}
+			n, err := c.Conn.Read(p)
+			c.skip -= n
+			return n, err
+		case c.done:
+			return c.Conn.Read(p)
+		case !c.prefaceRead:
+			buf, err := c.readPreface()
+			if len(buf) == 0 {
+				return 0, err
+			}
+			c.pending = buf
+			continue
+		}
+
+		hdr := make([]byte, http2FrameHeaderLen)
+		if _, err := io.ReadFull(c.Conn, hdr); err != nil {
+			return 0, err
+		}
+		length := int(hdr[0])<<16 | int(hdr[1])<<8 | int(hdr[2])
+		if http2.FrameType(hdr[3]) == http2.FrameSettings &&
+			http2.Flags(hdr[4]).Has(http2.FlagSettingsAck) && length == 0 {
+			// acknowledges the SETTINGS sent by the matcher, drop it
+			c.done = true
+			continue
+		}
+		c.pending = hdr
+		c.skip = length
+	}
+}
+
+// readPreface reads the connection until it differs from the HTTP/2
+// client preface, the connections without it are passed through.
+func (c *settingsAckFilterConn) readPreface() ([]byte, error) {
+	buf := make([]byte, len(http2.ClientPreface))
+	last := 0
+	for last < len(buf) {
+		n, err := c.Conn.Read(buf[last:])
+		last += n
+		if string(buf[:last]) != http2.ClientPreface[:last] {
+			c.done = true
+			break
+		}
+		if err != nil {
+			c.done = true
+			return buf[:last], err
+		}
+	}
+	c.prefaceRead = true
+	return buf[:last], nil
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func Test_isGRPCContentType(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"application/grpc", true},
+		{"application/grpc+proto", true},
+		{"application/grpc;charset=utf-8", true},
+		{"application/grpc-web", false},
+		{"application/grpc-web+proto", false},
+		{"application/json", false},
+		{"", false},
+	}
+	for _, tc := range tests {
+		if got := isGRPCContentType(tc.in); got != tc.want {
+			t.Errorf("isGRPCContentType(%q) = %v, want %v", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestServer_gRPCAndH2C(t *testing.T) {
+	srv := NewServer(0)
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- srv.Run(testService{delay: 300 * time.Millisecond})
+	}()
+	<-srv.Ready()
+	addr := srv.HTTPAddr().String()
+
+	conn, err := grpc.Dial(addr, grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	got, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil || got.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Fatalf("Check() = %v, %v, want SERVING", got, err)
+	}
+
+	// HTTP/2 with prior knowledge
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+	body := make(chan string, 1)
+	go func() {
+		rsp, err := client.Get("http://" + addr + "/slow")
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer rsp.Body.Close()
+		buf, _ := ioutil.ReadAll(rsp.Body)
+		body <- rsp.Proto + " " + string(buf)
+	}()
+
+	// let the request reach the handler, then stop the server
+	time.Sleep(100 * time.Millisecond)
+	go srv.Stop()
+
+	select {
+	case got := <-body:
+		if got != "HTTP/2.0 done" {
+			t.Errorf("in-flight h2c request wasn't drained, got %q", got)
+		}
+	case err := <-runErr:
+		t.Fatalf("Run() = %v returned before the h2c request finished", err)
+	}
+	if err := <-runErr; err != nil {
+		t.Errorf("Run() error = %v", err)
+	}
+}
+
+func Test_settingsAckFilterConn(t *testing.T) {
+	in := bytes.NewBuffer(nil)
+	in.WriteString(http2.ClientPreface)
+	fr := http2.NewFramer(in, nil)
+	fr.WriteSettings()
+	fr.WriteSettingsAck()
+	fr.WritePing(false, [8]byte{1})
+	fr.WriteSettingsAck()
+
+	want := bytes.NewBuffer(nil)
+	want.WriteString(http2.ClientPreface)
+	fr = http2.NewFramer(want, nil)
+	fr.WriteSettings()
+	fr.WritePing(false, [8]byte{1})
+	fr.WriteSettingsAck()
+
+	client, server := net.Pipe()
+	go func() {
+		client.Write(in.Bytes())
+		client.Close()
+	}()
+
+	got, err := ioutil.ReadAll(&settingsAckFilterConn{Conn: server})
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if !bytes.Equal(got, want.Bytes()) {
+		t.Errorf("first SETTINGS ACK wasn't removed:\ngot  %x\nwant %x", got, want.Bytes())
+	}
+}
+
+func Test_settingsAckFilterConn_http1(t *testing.T) {
+	const req = "GET / HTTP/1.0\r\n\r\n"
+	client, server := net.Pipe()
+	go func() {
+		client.Write([]byte(req))
+		client.Close()
+	}()
+
+	got, err := ioutil.ReadAll(&settingsAckFilterConn{Conn: server})
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if string(got) != req {
+		t.Errorf("ReadAll() = %q, want %q", got, req)
+	}
+}
+
+func TestServer_gRPCOptsInterceptor(t *testing.T) {
+	var calls []string
+	record := func(name string) grpc.UnaryServerInterceptor {
+		return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			calls = append(calls, name)
+			return handler(ctx, req)
+		}
+	}
+	srv := NewServer(0,
+		WithMetrics(nil),
+		WithGRPCUnaryMiddlewares(record("middleware")),
+		WithGRPCOpts([]grpc.ServerOption{grpc.UnaryInterceptor(record("option"))}),
+	)
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- srv.Run(testService{})
+	}()
+	<-srv.Ready()
+	defer func() {
+		srv.Stop()
+		<-runErr
+	}()
+
+	conn, err := grpc.Dial(srv.GRPCAddr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if want := []string{"option", "middleware"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("interceptors called %v, want %v", calls, want)
+	}
+}
+
+func TestServer_ShutdownSilentConn(t *testing.T) {
+	srv := NewServer(0)
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- srv.Run(testService{})
+	}()
+	<-srv.Ready()
+
+	// the connection is left in the cmux, it never sends enough to be matched
+	c, err := net.Dial("tcp", srv.HTTPAddr().String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer c.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+	if err := <-runErr; err != nil {
+		t.Errorf("Run() error = %v", err)
+	}
+}
@@ -0,0 +1,304 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// proxyHeaderTimeout limits the time to receive the PROXY protocol header.
+const proxyHeaderTimeout = 10 * time.Second
+
+// proxyV1Signature starts the text header of the PROXY protocol v1.
+var proxyV1Signature = []byte("PROXY ")
+
+// proxyV2Signature starts the binary header of the PROXY protocol v2.
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+const (
+	// proxyV1MaxLen is the maximal length of the v1 header line.
+	proxyV1MaxLen = 107
+	// proxyV2HeaderLen is the length of the v2 header before the addresses.
+	proxyV2HeaderLen = 16
+)
+
+// parseCIDRs parses the trusted networks, at least one is required.
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	if len(cidrs) == 0 {
+		return nil, errors.New("no trusted CIDRs")
+	}
+	ret := make([]*net.IPNet, 0, len(cidrs))
+	for _, s := range cidrs {
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid trusted CIDR %q", s)
+		}
+		ret = append(ret, n)
+	}
+	return ret, nil
+}
+
+// proxyListener reads the PROXY protocol header of the connections
+// accepted from the trusted sources.
+// The connections from other sources are passed as is.
+type proxyListener struct {
+	net.Listener
+	// trusted are the networks of the proxies.
+	trusted []*net.IPNet
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil || !l.isTrusted(c.RemoteAddr()) {
+		return c, err
+	}
+	// the header is read lazily, so a slow client doesn't block Accept
+	return &proxyConn{Conn: c, timeout: proxyHeaderTimeout}, nil
+}
+
+func (l *proxyListener) isTrusted(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, n := range l.trusted {
+		if n.Contains(tcp.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyConn replaces the addresses of the connection by the ones from
+// the PROXY protocol header.
+// The header is required; reading the connection fails if it is missing.
+type proxyConn struct {
+	net.Conn
+	timeout time.Duration
+
+	once   sync.Once
+	err    error
+	r      *bufio.Reader
+	local  net.Addr
+	remote net.Addr
+
+	mu sync.Mutex
+	// deadline is the read deadline set by the user of the connection.
+	deadline time.Time
+}
+
+func (c *proxyConn) Read(p []byte) (int, error) {
+	c.once.Do(c.init)
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.r.Read(p)
+}
+
+// RemoteAddr returns the client's address passed by the proxy.
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.once.Do(c.init)
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the address the client connected to the proxy at.
+func (c *proxyConn) LocalAddr() net.Addr {
+	c.once.Do(c.init)
+	if c.local != nil {
+		return c.local
+	}
+	return c.Conn.LocalAddr()
+}
+
+func (c *proxyConn) SetDeadline(t time.Time) error {
+	c.setDeadline(t)
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *proxyConn) SetReadDeadline(t time.Time) error {
+	c.setDeadline(t)
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *proxyConn) setDeadline(t time.Time) {
+	c.mu.Lock()
+	c.deadline = t
+	c.mu.Unlock()
+}
+
+// init reads the header within the timeout, restoring the user's
+// read deadline afterwards.
+func (c *proxyConn) init() {
+	c.mu.Lock()
+	deadline := c.deadline
+	c.mu.Unlock()
+
+	limit := time.Now().Add(c.timeout)
+	if !deadline.IsZero() && deadline.Before(limit) {
+		limit = deadline
+	}
+	c.Conn.SetReadDeadline(limit)
+	c.r = bufio.NewReader(c.Conn)
+	c.err = c.readHeader()
+	c.Conn.SetReadDeadline(deadline)
+
+	if c.err != nil {
+		c.err = errors.Wrap(c.err, "couldn't read PROXY protocol header")
+	}
+}
+
+func (c *proxyConn) readHeader() error {
+	first, err := c.r.Peek(1)
+	if err != nil {
+		return err
+	}
+	var sig []byte
+	switch first[0] {
+	case proxyV1Signature[0]:
+		sig = proxyV1Signature
+	case proxyV2Signature[0]:
+		sig = proxyV2Signature
+	default:
+		return errors.New("header is missing")
+	}
+
+	// the payload may start with the same byte, e.g. "POST"
+	start, err := c.r.Peek(len(sig))
+	if err != nil {
+		return err
+	}
+	switch {
+	case !bytes.Equal(start, sig):
+		return errors.New("header is missing")
+	case first[0] == proxyV1Signature[0]:
+		return c.readV1()
+	}
+	return c.readV2()
+}
+
+// readV1 reads the text header, e.g.
+// "PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n".
+func (c *proxyConn) readV1() error {
+	var line []byte
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) >= proxyV1MaxLen {
+			return errors.New("v1 header is too long")
+		}
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		line = append(line, b)
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) < 2 || fields[0] != "PROXY" {
+		return errors.Errorf("invalid v1 header %q", line)
+	}
+	switch fields[1] {
+	case "UNKNOWN":
+		// the proxy doesn't know the addresses, keep the connection's ones
+		return nil
+	case "TCP4", "TCP6":
+	default:
+		return errors.Errorf("unsupported v1 protocol %q", fields[1])
+	}
+	if len(fields) != 6 {
+		return errors.Errorf("invalid v1 header %q", line)
+	}
+
+	src, err := parseTCPAddr(fields[2], fields[4])
+	if err != nil {
+		return err
+	}
+	dst, err := parseTCPAddr(fields[3], fields[5])
+	if err != nil {
+		return err
+	}
+	c.remote, c.local = src, dst
+	return nil
+}
+
+func parseTCPAddr(host, port string) (*net.TCPAddr, error) {
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, errors.Errorf("invalid address %q", host)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, errors.Errorf("invalid port %q", port)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(p)}, nil
+}
+
+// readV2 reads the binary header.
+func (c *proxyConn) readV2() error {
+	hdr := make([]byte, proxyV2HeaderLen)
+	if _, err := io.ReadFull(c.r, hdr); err != nil {
+		return err
+	}
+	if !bytes.Equal(hdr[:len(proxyV2Signature)], proxyV2Signature) {
+		return errors.New("invalid v2 signature")
+	}
+	if version := hdr[12] >> 4; version != 2 {
+		return errors.Errorf("unsupported version %v", version)
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint16(hdr[14:]))
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return err
+	}
+
+	const (
+		cmdLocal = 0x0
+		cmdProxy = 0x1
+	)
+	switch hdr[12] & 0xf {
+	case cmdLocal:
+		// health checks of the proxy itself
+		return nil
+	case cmdProxy:
+	default:
+		return errors.Errorf("unsupported v2 command %#x", hdr[12]&0xf)
+	}
+
+	const (
+		tcp4 = 0x11
+		tcp6 = 0x21
+	)
+	var ipLen int
+	switch hdr[13] {
+	case tcp4:
+		ipLen = net.IPv4len
+	case tcp6:
+		ipLen = net.IPv6len
+	default:
+		// UDP, Unix sockets etc. are not relevant, keep the addresses
+		return nil
+	}
+	if len(payload) < 2*ipLen+4 {
+		return errors.New("v2 addresses are truncated")
+	}
+
+	// the rest of the payload are TLVs, they are not used
+	c.remote = &net.TCPAddr{
+		IP:   net.IP(payload[:ipLen]),
+		Port: int(binary.BigEndian.Uint16(payload[2*ipLen:])),
+	}
+	c.local = &net.TCPAddr{
+		IP:   net.IP(payload[ipLen : 2*ipLen]),
+		Port: int(binary.BigEndian.Uint16(payload[2*ipLen+2:])),
+	}
+	return nil
+}
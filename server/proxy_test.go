@@ -0,0 +1,84 @@
+package server
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"testing"
+)
+
+func proxyV2Header(src, dst *net.TCPAddr) []byte {
+	buf := append([]byte{}, proxyV2Signature...)
+	buf = append(buf, 0x21, 0x11, 0, 12)
+	buf = append(buf, src.IP.To4()...)
+	buf = append(buf, dst.IP.To4()...)
+	ports := make([]byte, 4)
+	binary.BigEndian.PutUint16(ports, uint16(src.Port))
+	binary.BigEndian.PutUint16(ports[2:], uint16(dst.Port))
+	return append(buf, ports...)
+}
+
+func Test_parseCIDRs(t *testing.T) {
+	if _, err := parseCIDRs(nil); err == nil {
+		t.Error("parseCIDRs(nil) succeeded, want error")
+	}
+	nets, err := parseCIDRs([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("parseCIDRs() error = %v", err)
+	}
+	l := &proxyListener{trusted: nets}
+	if !l.isTrusted(&net.TCPAddr{IP: net.IPv4(10, 1, 2, 3)}) || l.isTrusted(&net.TCPAddr{IP: net.IPv4(192, 168, 0, 1)}) {
+		t.Error("isTrusted() doesn't match the trusted network")
+	}
+}
+
+func Test_proxyConn(t *testing.T) {
+	src := &net.TCPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 56324}
+	dst := &net.TCPAddr{IP: net.IPv4(192, 168, 0, 11), Port: 443}
+
+	tests := []struct {
+		name       string
+		in         string
+		wantRemote string
+		wantErr    bool
+	}{
+		{"v1", "PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\nhello", src.String(), false},
+		{"v1 IPv6", "PROXY TCP6 ::1 ::2 56324 443\r\nhello", "[::1]:56324", false},
+		{"v1 unknown", "PROXY UNKNOWN\r\nhello", "pipe", false},
+		{"v2", string(proxyV2Header(src, dst)) + "hello", src.String(), false},
+		{"v2 local", string(proxyV2Signature) + "\x20\x00\x00\x00hello", "pipe", false},
+		{"no header", "hello", "", true},
+		{"gRPC preface", "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n", "", true},
+		{"POST", "POST / HTTP/1.1\r\nHost: localhost\r\n\r\n", "", true},
+		{"PUT", "PUT / HTTP/1.1\r\nHost: localhost\r\n\r\n", "", true},
+		{"CR", "\r\n\r\nhello, world", "", true},
+		{"invalid v1", "PROXY TCP4 nope\r\nhello", "", true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			go func() {
+				client.Write([]byte(tc.in))
+				client.Close()
+			}()
+
+			c := &proxyConn{Conn: server, timeout: proxyHeaderTimeout}
+			got, err := ioutil.ReadAll(c)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("ReadAll() succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadAll() error = %v", err)
+			}
+			if string(got) != "hello" {
+				t.Errorf("payload = %q, want %q", got, "hello")
+			}
+			if got := c.RemoteAddr().String(); got != tc.wantRemote {
+				t.Errorf("RemoteAddr() = %v, want %v", got, tc.wantRemote)
+			}
+		})
+	}
+}
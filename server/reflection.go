@@ -0,0 +1,76 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"sort"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/ra9form/yuki/transport/httpruntime"
+)
+
+// descriptorsPath is the HTTP path the descriptors are served at.
+const descriptorsPath = "/api/descriptors"
+
+// fileDescriptorSet returns the descriptors of the files declaring
+// the services registered at srv, along with their dependencies.
+// Dependencies precede the files depending on them.
+// Services that are not registered in protoregistry.GlobalFiles
+// (e.g. generated by gogo/protobuf) are skipped.
+func fileDescriptorSet(srv *grpc.Server) *descriptorpb.FileDescriptorSet {
+	var names []string
+	for name := range srv.GetServiceInfo() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	set := &descriptorpb.FileDescriptorSet{}
+	seen := map[string]bool{}
+	var add func(fd protoreflect.FileDescriptor)
+	add = func(fd protoreflect.FileDescriptor) {
+		if seen[fd.Path()] {
+			return
+		}
+		seen[fd.Path()] = true
+		imports := fd.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			add(imports.Get(i).FileDescriptor)
+		}
+		set.File = append(set.File, protodesc.ToFileDescriptorProto(fd))
+	}
+
+	for _, name := range names {
+		d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(name))
+		if err != nil {
+			continue
+		}
+		add(d.ParentFile())
+	}
+	return set
+}
+
+// serveDescriptors serves the FileDescriptorSet in the media type
+// negotiated by the marshalers, JSON by default.
+func serveDescriptors(marshalers *httpruntime.MarshalerRegistry, set *descriptorpb.FileDescriptorSet) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		m, err := marshalers.Outbound(r)
+		if err != nil {
+			httpruntime.SetError(r.Context(), r, w, err)
+			return
+		}
+
+		var buf bytes.Buffer
+		if err := m.Marshal(&buf, set); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", m.ContentType())
+		w.Write(buf.Bytes())
+	}
+}
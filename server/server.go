@@ -2,85 +2,424 @@ package server
 
 import (
 	"bytes"
+	"context"
 	"io"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/reflection"
 
+	"github.com/ra9form/yuki/server/log"
 	"github.com/ra9form/yuki/transport"
+	"github.com/ra9form/yuki/transport/httpruntime"
+	"github.com/ra9form/yuki/transport/httptransport"
 )
 
+// ErrServerStarted is returned by Run if the server was run already.
+var ErrServerStarted = errors.New("server was started already")
+
 // Server is a transport server.
 type Server struct {
 	opts      *serverOpts
 	listeners *listenerSet
 	srv       *serverSet
+
+	mu       sync.Mutex
+	started  bool
+	stopping bool
+	// ready is closed when the server starts serving requests.
+	ready chan struct{}
+	// stopped is closed when the Shutdown finishes.
+	stopped        chan struct{}
+	health         *health.Server
+	healthServices []string
+
+	// inherited holds the files passed by the parent process,
+	// nil unless InheritListeners is set.
+	inherited *inherited
 }
 
 // NewServer creates a Server listening on the rpcPort.
 // Pass additional Options to mutate its behaviour.
 // By default, HTTP JSON handler and gRPC are listening on the same
-// port, admin port is p+2 and profile port is p+4.
+// port. Use WithAdminPort to serve operational endpoints (probes, pprof etc.)
+// on a separate port.
 func NewServer(rpcPort int, opts ...Option) *Server {
 	serverOpts := defaultServerOpts(rpcPort)
 	for _, opt := range opts {
 		opt(serverOpts)
 	}
-	return &Server{opts: serverOpts}
+	return &Server{
+		opts:    serverOpts,
+		ready:   make(chan struct{}),
+		stopped: make(chan struct{}),
+		health:  health.NewServer(),
+	}
 }
 
 // Run starts processing requests to the service.
-// It blocks indefinitely, run asynchronously to do anything after that.
+// It blocks until the server is stopped, run asynchronously to do anything
+// after that.
+// Run returns nil if the server was stopped via Stop or Shutdown.
 func (s *Server) Run(svc transport.Service) error {
+	return s.RunContext(context.Background(), svc)
+}
+
+// RunContext starts processing requests to the service and blocks
+// until the server is stopped.
+// The server is stopped gracefully when ctx is done or one of the
+// ShutdownSignals is received, see Stop.
+// A Server can be run only once, ErrServerStarted is returned afterwards.
+func (s *Server) RunContext(ctx context.Context, svc transport.Service) error {
+	s.mu.Lock()
+	started := s.started
+	s.started = true
+	s.mu.Unlock()
+	if started {
+		return ErrServerStarted
+	}
+
+	if len(s.opts.ShutdownSignals) > 0 {
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(ctx, s.opts.ShutdownSignals...)
+		defer stop()
+	}
+
+	var upgrade chan os.Signal
+	if len(s.opts.UpgradeSignals) > 0 {
+		upgrade = make(chan os.Signal, 1)
+		signal.Notify(upgrade, s.opts.UpgradeSignals...)
+		defer signal.Stop(upgrade)
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- s.start(ctx, svc)
+	}()
+
+	for {
+		select {
+		case err := <-errChan:
+			return err
+		case <-upgrade:
+			uctx, cancel := context.WithTimeout(ctx, s.opts.UpgradeTimeout)
+			err := s.Upgrade(uctx)
+			cancel()
+			if err != nil {
+				s.opts.Logger.Log(ctx, log.LevelError, "upgrade failed", log.Err(err))
+			}
+			continue
+		case <-ctx.Done():
+		}
+
+		s.Stop()
+		return <-errChan
+	}
+}
+
+// Ready returns a channel that is closed when the server has bound
+// its listeners and started serving requests.
+func (s *Server) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// GRPCAddr returns the address gRPC requests are served on.
+// It returns nil if the server is not running.
+func (s *Server) GRPCAddr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listeners == nil {
+		return nil
+	}
+	return s.listeners.GRPC.Addr()
+}
+
+// HTTPAddr returns the address HTTP requests are served on.
+// It returns nil if the server is not running.
+func (s *Server) HTTPAddr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listeners == nil {
+		return nil
+	}
+	return s.listeners.HTTP.Addr()
+}
+
+// AdminAddr returns the address admin endpoints are served on.
+// It returns nil if the server is not running or admin server is disabled.
+func (s *Server) AdminAddr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.listeners == nil || s.listeners.Admin == nil {
+		return nil
+	}
+	return s.listeners.Admin.Addr()
+}
+
+func (s *Server) start(ctx context.Context, svc transport.Service) error {
 	desc := svc.GetDescription()
 
-	var err error
-	s.listeners, err = newListenerSet(s.opts)
+	opts := s.opts
+	if s.opts.InheritListeners {
+		inh, err := inheritFiles()
+		if err != nil {
+			return errors.Wrap(err, "couldn't inherit listeners")
+		}
+		opts = inh.apply(s.opts)
+		inh.Close()
+		s.inherited = inh
+	}
+
+	listeners, err := newListenerSet(opts)
 	if err != nil {
 		return errors.Wrap(err, "couldn't create listeners")
 	}
 
-	s.srv = newServerSet(s.listeners, s.opts)
-	// Inject static Swagger as root handler
-	s.srv.http.HandleFunc("/swagger.json", func(w http.ResponseWriter, req *http.Request) {
-		io.Copy(w, bytes.NewReader(desc.SwaggerDef()))
-	})
+	srv := newServerSet(listeners, s.opts)
+	if listeners.Admin == nil {
+		// Inject static Swagger and the probes as root handlers unless
+		// the admin server serves them
+		srv.http.HandleFunc("/swagger.json", func(w http.ResponseWriter, req *http.Request) {
+			io.Copy(w, bytes.NewReader(desc.SwaggerDef()))
+		})
+		srv.http.Get("/healthz", s.serveHealth)
+		srv.http.Get("/readyz", s.serveReady)
+	}
 
-	// apply gRPC interceptor
+	// apply gRPC interceptor and marshalers
 	if d, ok := desc.(transport.ConfigurableServiceDesc); ok {
-		d.Apply(transport.WithUnaryInterceptor(s.opts.GRPCUnaryInterceptor))
+		if srv.unary != nil {
+			d.Apply(transport.WithUnaryInterceptor(srv.unary))
+		}
+		if s.opts.Marshalers != nil {
+			d.Apply(httptransport.OptionDefaultMarshalers{Registry: s.opts.Marshalers})
+		}
+		d.Apply(httptransport.OptionUnknownFieldsLogger{Logger: s.logUnknownFields})
 	}
 
 	// Register everything
-	desc.RegisterHTTP(s.srv.http)
-	desc.RegisterGRPC(s.srv.grpc)
+	desc.RegisterHTTP(srv.http)
+	desc.RegisterGRPC(srv.grpc)
+	if err := s.registerHealth(srv.grpc); err != nil {
+		listeners.Close()
+		return err
+	}
+	if s.opts.Reflection {
+		reflection.Register(srv.grpc)
+		marshalers := s.opts.Marshalers
+		if marshalers == nil {
+			marshalers = httpruntime.DefaultRegistry
+		}
+		srv.http.Get(descriptorsPath, serveDescriptors(marshalers, fileDescriptorSet(srv.grpc)))
+	}
+
+	if listeners.Admin != nil {
+		srv.admin = s.opts.newAdminServer(s.newAdminHandler(desc, srv.http))
+	}
+
+	for _, hook := range s.opts.OnStart {
+		if err := hook(ctx); err != nil {
+			listeners.Close()
+			return errors.Wrap(err, "start hook failed")
+		}
+	}
+
+	s.mu.Lock()
+	if s.stopping {
+		// Shutdown was called before the server started
+		s.mu.Unlock()
+		listeners.Close()
+		return nil
+	}
+	s.listeners = listeners
+	s.srv = srv
+	s.mu.Unlock()
 
 	return s.run()
 }
 
 func (s *Server) run() error {
-	errChan := make(chan error, 5)
+	var wg sync.WaitGroup
+	errChan := make(chan error, 4)
 
-	if s.listeners.mainListener != nil {
+	serve := func(f func() error) {
+		wg.Add(1)
 		go func() {
-			err := s.listeners.mainListener.Serve()
-			errChan <- err
+			defer wg.Done()
+			errChan <- f()
 		}()
 	}
+
+	if s.listeners.mainListener != nil {
+		serve(s.listeners.mainListener.Serve)
+	}
+	serve(func() error {
+		return s.srv.httpServer.Serve(s.listeners.HTTP)
+	})
+	serve(func() error {
+		return s.srv.grpc.Serve(s.listeners.GRPC)
+	})
+	if s.srv.admin != nil {
+		serve(func() error {
+			return s.srv.admin.Serve(s.listeners.Admin)
+		})
+	}
+	close(s.ready)
+	s.inherited.notifyReady()
+
+	err := <-errChan
+	if s.isStopping() {
+		// every server returns once the listeners are closed;
+		// wait for in-flight calls to drain as well
+		wg.Wait()
+		<-s.stopped
+		return nil
+	}
+
+	// one of the servers has failed on its own, bring down the rest
+	s.listeners.Close()
+	s.srv.httpServer.Close()
+	s.srv.h2c.Close()
+	if s.srv.admin != nil {
+		s.srv.admin.Close()
+	}
+	s.srv.grpc.Stop()
+	wg.Wait()
+	return err
+}
+
+func (s *Server) isStopping() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopping
+}
+
+// Stop stops the server gracefully.
+// In-flight calls are given the ShutdownTimeout to finish.
+func (s *Server) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.ShutdownTimeout)
+	defer cancel()
+
+	_ = s.Shutdown(ctx)
+}
+
+// Shutdown stops accepting new connections on every listener and waits
+// for in-flight HTTP requests and gRPC calls to finish.
+// The health service reports NOT_SERVING from the start of the Shutdown,
+// the listeners are closed after the ShutdownDelay.
+// If ctx expires first, remaining connections are closed forcibly and
+// ctx's error is returned.
+// OnStop hooks are called afterwards.
+// Run returns nil after the Shutdown completes.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if s.stopping {
+		s.mu.Unlock()
+		select {
+		case <-s.stopped:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	s.stopping = true
+	srv, listeners := s.srv, s.listeners
+	s.mu.Unlock()
+
+	defer close(s.stopped)
+	if srv == nil {
+		// not running yet
+		return nil
+	}
+
+	// let the load balancers stop routing calls before the listeners
+	// are closed
+	s.health.Shutdown()
+	if s.opts.ShutdownDelay > 0 {
+		select {
+		case <-time.After(s.opts.ShutdownDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	listeners.ClosePublic()
+
+	var wg sync.WaitGroup
+	var httpErr, grpcErr error
+	wg.Add(2)
 	go func() {
-		err := http.Serve(s.listeners.HTTP, s.srv.http)
-		errChan <- err
+		defer wg.Done()
+		httpErr = shutdownHTTP(ctx, srv.httpServer)
+		if err := srv.h2c.Shutdown(ctx); httpErr == nil {
+			httpErr = err
+		}
 	}()
 	go func() {
-		err := s.srv.grpc.Serve(s.listeners.GRPC)
-		errChan <- err
+		defer wg.Done()
+		grpcErr = shutdownGRPC(ctx, srv)
 	}()
+	wg.Wait()
+	if srv.admin != nil {
+		// admin endpoints are served until the main servers are drained
+		_ = shutdownHTTP(ctx, srv.admin)
+	}
+
+	var hookErr error
+	for _, hook := range s.opts.OnStop {
+		if err := hook(ctx); err != nil && hookErr == nil {
+			hookErr = err
+		}
+	}
 
-	return <-errChan
+	switch {
+	case httpErr != nil:
+		return errors.Wrap(httpErr, "couldn't drain HTTP server")
+	case grpcErr != nil:
+		return errors.Wrap(grpcErr, "couldn't drain gRPC server")
+	}
+	return errors.Wrap(hookErr, "stop hook failed")
 }
 
-// Stop stops the server gracefully.
-func (s *Server) Stop() {
-	// TODO grace HTTP
-	s.srv.grpc.GracefulStop()
+func shutdownHTTP(ctx context.Context, srv *http.Server) error {
+	err := srv.Shutdown(ctx)
+	if err != nil {
+		srv.Close()
+	}
+	return err
+}
+
+func shutdownGRPC(ctx context.Context, srv *serverSet) error {
+	done := make(chan struct{})
+	go func() {
+		srv.grpc.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		srv.grpc.Stop()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// logUnknownFields reports the unknown fields of the HTTP requests
+// for the httptransport.UnknownFieldsLog policy.
+func (s *Server) logUnknownFields(ctx context.Context, location httptransport.Location, names []string) {
+	s.opts.Logger.Log(ctx, log.LevelWarning, "unknown request fields",
+		log.F("location", string(location)),
+		log.F("fields", strings.Join(names, ",")),
+	)
 }
@@ -0,0 +1,439 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/descriptorpb"
+
+	"github.com/ra9form/yuki/transport"
+	"github.com/ra9form/yuki/transport/httpruntime"
+	"github.com/ra9form/yuki/transport/swagger"
+)
+
+// logBuffer collects the output of the loggers under test.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// testService serves a slow HTTP endpoint at /slow.
+type testService struct {
+	delay time.Duration
+}
+
+func (s testService) GetDescription() transport.ServiceDesc { return s }
+
+func (s testService) RegisterGRPC(*grpc.Server) {}
+
+func (s testService) RegisterHTTP(r transport.Router) {
+	r.Handle("/slow", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(s.delay)
+		w.Write([]byte("done"))
+	}))
+}
+
+func (s testService) SwaggerDef(...swagger.Option) []byte { return []byte("{}") }
+
+type ctxKey struct{}
+
+func TestServer_RunContext(t *testing.T) {
+	var started, stopped bool
+	srv := NewServer(0,
+		WithOnStart(func(ctx context.Context) error {
+			started = ctx.Value(ctxKey{}) == "run"
+			return nil
+		}),
+		WithOnStop(func(context.Context) error {
+			stopped = true
+			return nil
+		}),
+	)
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "run"))
+	defer cancel()
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- srv.RunContext(ctx, testService{delay: 200 * time.Millisecond})
+	}()
+
+	select {
+	case <-srv.Ready():
+	case err := <-runErr:
+		t.Fatalf("server exited before becoming ready: %v", err)
+	}
+	if !started {
+		t.Error("OnStart hook wasn't called with the RunContext ctx")
+	}
+	if err := srv.Run(testService{}); err != ErrServerStarted {
+		t.Errorf("second Run() = %v, want %v", err, ErrServerStarted)
+	}
+
+	body := make(chan string, 1)
+	go func() {
+		rsp, err := http.Get("http://" + srv.HTTPAddr().String() + "/slow")
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer rsp.Body.Close()
+		buf, _ := ioutil.ReadAll(rsp.Body)
+		body <- string(buf)
+	}()
+
+	// let the request reach the handler, then stop the server
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	if got := <-body; got != "done" {
+		t.Errorf("in-flight request wasn't drained, got %q", got)
+	}
+	if err := <-runErr; err != nil {
+		t.Errorf("RunContext() = %v, want nil", err)
+	}
+	if !stopped {
+		t.Error("OnStop hook wasn't called")
+	}
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	stopped := make(chan struct{})
+	slow := func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		time.Sleep(200 * time.Millisecond)
+		return handler(ctx, req)
+	}
+	srv := NewServer(0,
+		WithGRPCUnaryMiddlewares(slow),
+		WithOnStop(func(context.Context) error {
+			close(stopped)
+			return nil
+		}),
+	)
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- srv.Run(testService{delay: 200 * time.Millisecond})
+	}()
+	<-srv.Ready()
+	addr := srv.HTTPAddr().String()
+
+	conn, err := grpc.Dial(addr, grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+
+	httpErr, grpcErr := make(chan error, 1), make(chan error, 1)
+	go func() {
+		rsp, err := http.Get("http://" + addr + "/slow")
+		if err == nil {
+			var buf []byte
+			buf, err = ioutil.ReadAll(rsp.Body)
+			rsp.Body.Close()
+			if err == nil && string(buf) != "done" {
+				err = fmt.Errorf("got %q", buf)
+			}
+		}
+		httpErr <- err
+	}()
+	go func() {
+		_, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+		grpcErr <- err
+	}()
+
+	// let the calls reach the handlers, then shut the server down
+	time.Sleep(50 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		t.Errorf("Shutdown() error = %v", err)
+	}
+	if err := <-httpErr; err != nil {
+		t.Errorf("in-flight HTTP request wasn't drained: %v", err)
+	}
+	if err := <-grpcErr; err != nil {
+		t.Errorf("in-flight gRPC call wasn't drained: %v", err)
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Error("OnStop hook wasn't called by Shutdown")
+	}
+	if err := <-runErr; err != nil {
+		t.Errorf("Run() = %v, want nil", err)
+	}
+}
+
+func TestServer_WithListener(t *testing.T) {
+	li := bufconn.Listen(1 << 20)
+	srv := NewServer(0, WithListener(li))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- srv.RunContext(ctx, testService{})
+	}()
+	<-srv.Ready()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(context.Context, string, string) (net.Conn, error) {
+			return li.Dial()
+		},
+	}}
+	rsp, err := client.Get("http://bufconn/slow")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	buf, _ := ioutil.ReadAll(rsp.Body)
+	rsp.Body.Close()
+	if string(buf) != "done" {
+		t.Errorf("body = %q, want %q", buf, "done")
+	}
+
+	cancel()
+	if err := <-runErr; err != nil {
+		t.Errorf("RunContext() error = %v", err)
+	}
+}
+
+func Test_newListener_inUse(t *testing.T) {
+	li, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer li.Close()
+	port := li.Addr().(*net.TCPAddr).Port
+
+	start := time.Now()
+	_, err = newListener(port, ListenRetry{Wait: 10 * time.Millisecond, Timeout: 50 * time.Millisecond})
+	if err == nil {
+		t.Fatal("newListener() succeeded on a busy port")
+	}
+	if d := time.Since(start); d < 40*time.Millisecond || d > time.Second {
+		t.Errorf("newListener() returned after %v, want about 50ms", d)
+	}
+}
+
+func TestServer_Health(t *testing.T) {
+	srv := NewServer(0, WithAdminPort(0))
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- srv.Run(testService{})
+	}()
+	<-srv.Ready()
+
+	rsp, err := http.Get("http://" + srv.AdminAddr().String() + "/healthz")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	var info healthInfo
+	err = json.NewDecoder(rsp.Body).Decode(&info)
+	rsp.Body.Close()
+	if err != nil {
+		t.Fatalf("couldn't decode /healthz: %v", err)
+	}
+	if rsp.StatusCode != http.StatusOK || info.Status != "SERVING" {
+		t.Errorf("/healthz = %v %v, want 200 SERVING", rsp.StatusCode, info.Status)
+	}
+
+	rsp, err = http.Get("http://" + srv.AdminAddr().String() + "/healthz?service=unknown")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusNotFound {
+		t.Errorf("/healthz of unknown service = %v, want 404", rsp.StatusCode)
+	}
+
+	rsp, err = http.Get("http://" + srv.AdminAddr().String() + "/swagger.json")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		t.Errorf("/swagger.json = %v, want 200", rsp.StatusCode)
+	}
+	rsp, err = http.Get("http://" + srv.AdminAddr().String() + "/routes")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	var routes []routeInfo
+	err = json.NewDecoder(rsp.Body).Decode(&routes)
+	rsp.Body.Close()
+	if err != nil {
+		t.Fatalf("couldn't decode /routes: %v", err)
+	}
+	for _, r := range routes {
+		if r.Pattern == "/swagger.json" {
+			t.Error("/swagger.json is served on the public port")
+		}
+	}
+
+	srv.Stop()
+	if err := <-runErr; err != nil {
+		t.Errorf("Run() error = %v", err)
+	}
+
+	got, err := srv.Health().Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if got.Status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("status after Stop = %v, want NOT_SERVING", got.Status)
+	}
+}
+
+// healthService registers the health service of its own.
+type healthService struct {
+	testService
+}
+
+func (s healthService) GetDescription() transport.ServiceDesc { return s }
+
+func (s healthService) RegisterGRPC(srv *grpc.Server) {
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+}
+
+func TestServer_HealthPublic(t *testing.T) {
+	srv := NewServer(0)
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- srv.Run(testService{})
+	}()
+	<-srv.Ready()
+	defer func() {
+		srv.Stop()
+		<-runErr
+	}()
+
+	for _, path := range []string{"/healthz", "/readyz"} {
+		rsp, err := http.Get("http://" + srv.HTTPAddr().String() + path)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		rsp.Body.Close()
+		if rsp.StatusCode != http.StatusOK {
+			t.Errorf("public %v = %v, want 200", path, rsp.StatusCode)
+		}
+	}
+}
+
+func TestServer_ownHealth(t *testing.T) {
+	err := NewServer(0).Run(healthService{})
+	if err == nil {
+		t.Error("Run() succeeded with the service's own health service, want error")
+	}
+}
+
+func TestServer_WithReflection(t *testing.T) {
+	srv := NewServer(0, WithReflection())
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- srv.Run(testService{})
+	}()
+	<-srv.Ready()
+	defer func() {
+		srv.Stop()
+		<-runErr
+	}()
+
+	rsp, err := http.Get("http://" + srv.HTTPAddr().String() + "/api/descriptors")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	buf, _ := ioutil.ReadAll(rsp.Body)
+	rsp.Body.Close()
+
+	var set descriptorpb.FileDescriptorSet
+	if err := protojson.Unmarshal(buf, &set); err != nil {
+		t.Fatalf("couldn't decode descriptors: %v", err)
+	}
+	files := map[string]bool{}
+	for _, f := range set.File {
+		files[f.GetName()] = true
+	}
+	for _, want := range []string{"grpc/health/v1/health.proto", "reflection/grpc_reflection_v1alpha/reflection.proto"} {
+		if !files[want] {
+			t.Errorf("descriptors of %v are missing, got %v", want, files)
+		}
+	}
+
+	for accept, want := range map[string]string{
+		"application/json;q=0.5, application/x-protobuf": "application/x-protobuf",
+		"text/*":    "",
+		"image/png": "",
+	} {
+		req, _ := http.NewRequest("GET", "http://"+srv.HTTPAddr().String()+"/api/descriptors", nil)
+		req.Header.Set("Accept", accept)
+		rsp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Do() error = %v", err)
+		}
+		rsp.Body.Close()
+		if want == "" {
+			if rsp.StatusCode != http.StatusNotAcceptable {
+				t.Errorf("Accept %q: status = %v, want 406", accept, rsp.StatusCode)
+			}
+			continue
+		}
+		if got := rsp.Header.Get("Content-Type"); !strings.HasPrefix(got, want) {
+			t.Errorf("Accept %q: Content-Type = %q, want %q", accept, got, want)
+		}
+	}
+}
+
+func TestServer_WithReflectionMarshalers(t *testing.T) {
+	reg := httpruntime.NewMarshalerRegistry()
+	reg.Override(httpruntime.ContentTypeProtoText, httpruntime.MarshalerPbText{})
+	srv := NewServer(0, WithReflection(), WithMarshalers(reg))
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- srv.Run(testService{})
+	}()
+	<-srv.Ready()
+	defer func() {
+		srv.Stop()
+		<-runErr
+	}()
+
+	req, _ := http.NewRequest("GET", "http://"+srv.HTTPAddr().String()+"/api/descriptors", nil)
+	req.Header.Set("Accept", "text/*")
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	rsp.Body.Close()
+	if got := rsp.Header.Get("Content-Type"); !strings.HasPrefix(got, httpruntime.ContentTypeProtoText) {
+		t.Errorf("Content-Type = %q, want %q", got, httpruntime.ContentTypeProtoText)
+	}
+}
@@ -1,25 +1,149 @@
 package server
 
 import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/go-chi/chi"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	"google.golang.org/grpc"
 )
 
 type serverSet struct {
-	http chi.Router
-	grpc *grpc.Server
+	http       chi.Router
+	httpServer *http.Server
+	grpc       *grpc.Server
+	admin      *http.Server // nil if admin server is disabled
+	// h2c are the HTTP/2 cleartext connections of the httpServer.
+	h2c *h2cConns
+
+	// unary is the interceptor applied to both gRPC and HTTP calls,
+	// nil if there are no interceptors.
+	unary grpc.UnaryServerInterceptor
 }
 
 func newServerSet(listeners *listenerSet, opts *serverOpts) *serverSet {
-	http := chi.NewMux()
+	mux := chi.NewMux()
 	if len(opts.HTTPMiddlewares) > 0 {
-		http.Use(opts.HTTPMiddlewares...)
+		mux.Use(opts.HTTPMiddlewares...)
+	}
+	mux.Mount("/", opts.HTTPMux)
+
+	var grpcOpts []grpc.ServerOption
+	var handler http.Handler = mux
+	if listeners.tls != nil {
+		grpcOpts = append(grpcOpts, grpc.Creds(terminatedTLSCreds{}))
+		handler = withTLSState(handler)
 	}
-	http.Mount("/", opts.HTTPMux)
+	// chained, so the interceptors set by GRPCOpts are applied as well
+	unary := opts.unaryInterceptor()
+	if unary != nil {
+		grpcOpts = append(grpcOpts, grpc.ChainUnaryInterceptor(unary))
+	}
+	if stream := opts.streamInterceptor(); stream != nil {
+		grpcOpts = append(grpcOpts, grpc.ChainStreamInterceptor(stream))
+	}
+	grpcOpts = append(grpcOpts, opts.GRPCOpts...)
+
+	// serve HTTP/2 JSON clients using prior knowledge as well
+	h2s := &http2.Server{}
+	h2cConns := newH2CConns()
+	httpServer := opts.newHTTPServer(h2cConns.track(h2c.NewHandler(handler, h2s)))
+	httpServer.ConnContext = connContext
+	// makes Shutdown send GOAWAY to the HTTP/2 connections
+	_ = http2.ConfigureServer(httpServer, h2s)
 
 	srv := &serverSet{
-		grpc: grpc.NewServer(opts.GRPCOpts...),
-		http: http,
+		grpc:       grpc.NewServer(grpcOpts...),
+		http:       mux,
+		httpServer: httpServer,
+		h2c:        h2cConns,
+		unary:      unary,
 	}
 	return srv
 }
+
+// h2cConns tracks the HTTP/2 cleartext connections. The h2c handler
+// hijacks them, so http.Server.Shutdown neither waits for nor closes them.
+type h2cConns struct {
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+}
+
+func newH2CConns() *h2cConns {
+	return &h2cConns{conns: map[net.Conn]struct{}{}}
+}
+
+// track wraps the h2c handler, which serves the HTTP/2 connection
+// until it is closed.
+func (t *h2cConns) track(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, ok := r.Context().Value(ctxKeyConn{}).(net.Conn)
+		if !ok || !isH2C(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		t.mu.Lock()
+		t.conns[c] = struct{}{}
+		t.mu.Unlock()
+		defer func() {
+			t.mu.Lock()
+			delete(t.conns, c)
+			t.mu.Unlock()
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isH2C returns true for the HTTP/2 preface read as a request with
+// prior knowledge and for the upgrade to h2c.
+func isH2C(r *http.Request) bool {
+	if r.Method == "PRI" && r.URL.Path == "*" && r.Proto == "HTTP/2.0" {
+		return true
+	}
+	return strings.EqualFold(r.Header.Get("Upgrade"), "h2c")
+}
+
+// Shutdown waits for the connections to finish their streams, they
+// receive GOAWAY by the http.Server.Shutdown.
+// The connections left are closed once ctx is done.
+func (t *h2cConns) Shutdown(ctx context.Context) error {
+	ticker := time.NewTicker(h2cPollInterval)
+	defer ticker.Stop()
+	for {
+		if t.len() == 0 {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			t.Close()
+			return ctx.Err()
+		}
+	}
+}
+
+// h2cPollInterval is the interval Shutdown checks the connections at,
+// like http.Server.Shutdown does.
+const h2cPollInterval = 10 * time.Millisecond
+
+func (t *h2cConns) len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.conns)
+}
+
+// Close closes the connections.
+func (t *h2cConns) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for c := range t.conns {
+		c.Close()
+	}
+}
@@ -0,0 +1,246 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/soheilhy/cmux"
+	"google.golang.org/grpc/credentials"
+)
+
+// certReloadInterval is the minimal interval between certificate files' checks.
+const certReloadInterval = time.Second
+
+// tlsConfig returns TLS config for the public listeners or nil if TLS
+// is disabled.
+func (o *serverOpts) tlsConfig() (*tls.Config, error) {
+	if o.TLSConfig == nil && o.TLSCertFile == "" {
+		if o.TLSClientCAFile != "" || o.TLSClientAuth != tls.NoClientCert {
+			return nil, errors.New("client authentication requires TLS to be enabled")
+		}
+		return nil, nil
+	}
+
+	cfg := &tls.Config{}
+	if o.TLSConfig != nil {
+		cfg = o.TLSConfig.Clone()
+	}
+
+	if o.TLSCertFile != "" {
+		r, err := newCertReloader(o.TLSCertFile, o.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.GetCertificate = r.GetCertificate
+	}
+
+	if o.TLSClientCAFile != "" {
+		buf, err := ioutil.ReadFile(o.TLSClientCAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "couldn't read client CA file")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(buf) {
+			return nil, errors.Errorf("no certificates found in %v", o.TLSClientCAFile)
+		}
+		cfg.ClientCAs = pool
+	}
+	if o.TLSClientAuth != tls.NoClientCert {
+		cfg.ClientAuth = o.TLSClientAuth
+	}
+	if cfg.ClientAuth >= tls.VerifyClientCertIfGiven && cfg.ClientCAs == nil {
+		return nil, errors.New("client certificates' verification requires client CAs")
+	}
+
+	// both protocols are served on the same listener
+	cfg.NextProtos = appendMissing(cfg.NextProtos, "h2", "http/1.1")
+	return cfg, nil
+}
+
+func appendMissing(ss []string, vv ...string) []string {
+	for _, v := range vv {
+		found := false
+		for _, s := range ss {
+			if s == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			ss = append(ss, v)
+		}
+	}
+	return ss
+}
+
+// certReloader serves a certificate loaded from the disk.
+// The files are reloaded when their modification times change.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	lastCheck time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile, lastCheck: time.Now()}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+// The files are checked by a single handshake at most once per
+// certReloadInterval, the others are served the current certificate.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	check := time.Since(r.lastCheck) > certReloadInterval
+	if check {
+		r.lastCheck = time.Now()
+	}
+	r.mu.Unlock()
+
+	if check {
+		// keep serving the old certificate if new files are broken
+		_ = r.reload()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cert, nil
+}
+
+// reload loads the certificate if the files were changed since the last load.
+// The files are read without holding the lock.
+func (r *certReloader) reload() error {
+	modTime, err := latestModTime(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	loaded := r.cert != nil && modTime.Equal(r.modTime)
+	r.mu.Unlock()
+	if loaded {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return errors.Wrap(err, "couldn't load TLS certificate")
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = modTime
+	r.mu.Unlock()
+	return nil
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+	var ret time.Time
+	for _, f := range files {
+		st, err := os.Stat(f)
+		if err != nil {
+			return ret, errors.Wrap(err, "couldn't stat TLS certificate")
+		}
+		if st.ModTime().After(ret) {
+			ret = st.ModTime()
+		}
+	}
+	return ret, nil
+}
+
+// tlsConnOf returns the TLS connection underlying c.
+func tlsConnOf(c net.Conn) (*tls.Conn, bool) {
+	for {
+		switch cc := c.(type) {
+		case *tls.Conn:
+			return cc, true
+		case *cmux.MuxConn:
+			c = cc.Conn
+		case *settingsAckFilterConn:
+			c = cc.Conn
+		case *sniffedConn:
+			c = cc.Conn
+		default:
+			return nil, false
+		}
+	}
+}
+
+// terminatedTLSCreds provides gRPC with AuthInfo of connections
+// which TLS was terminated by the listener.
+type terminatedTLSCreds struct{}
+
+var _ credentials.TransportCredentials = terminatedTLSCreds{}
+
+func (terminatedTLSCreds) ClientHandshake(context.Context, string, net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return nil, nil, errors.New("terminatedTLSCreds can't be used by clients")
+}
+
+func (terminatedTLSCreds) ServerHandshake(c net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	tc, ok := tlsConnOf(c)
+	if !ok {
+		return c, nil, nil
+	}
+	// no-op if the connection was sniffed by the cmux already
+	if err := tc.Handshake(); err != nil {
+		return nil, nil, err
+	}
+	info := credentials.TLSInfo{
+		State:          tc.ConnectionState(),
+		CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.PrivacyAndIntegrity},
+	}
+	// return c itself to keep the data buffered by the cmux
+	return c, info, nil
+}
+
+// Info leaves SecurityVersion empty, since the version is negotiated
+// per connection; see credentials.TLSInfo.State.
+func (terminatedTLSCreds) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{SecurityProtocol: "tls"}
+}
+
+func (c terminatedTLSCreds) Clone() credentials.TransportCredentials {
+	return c
+}
+
+func (terminatedTLSCreds) OverrideServerName(string) error {
+	return nil
+}
+
+type ctxKeyConn struct{}
+
+// connContext saves the connection to the context; it is used as
+// http.Server.ConnContext.
+func connContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, ctxKeyConn{}, c)
+}
+
+// withTLSState sets http.Request.TLS for the requests received on
+// connections which TLS was terminated by the listener.
+func withTLSState(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil {
+			if c, ok := r.Context().Value(ctxKeyConn{}).(net.Conn); ok {
+				if tc, ok := tlsConnOf(c); ok {
+					state := tc.ConnectionState()
+					r = r.WithContext(r.Context())
+					r.TLS = &state
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
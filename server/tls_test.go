@@ -0,0 +1,306 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// testCA issues certificates for the tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pool: pool,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// issue returns PEM-encoded certificate and key for the common name.
+func (ca *testCA) issue(t *testing.T, cn string, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// runTLSServer runs the server until the test ends and returns
+// its public address.
+func runTLSServer(t *testing.T, opts ...Option) string {
+	srv := NewServer(0, opts...)
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- srv.Run(testService{})
+	}()
+	select {
+	case <-srv.Ready():
+	case err := <-runErr:
+		t.Fatalf("Run() error = %v", err)
+	}
+	t.Cleanup(func() {
+		srv.Stop()
+		<-runErr
+	})
+
+	_, port, _ := net.SplitHostPort(srv.HTTPAddr().String())
+	return net.JoinHostPort("localhost", port)
+}
+
+func TestServer_WithTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	certPEM, keyPEM := ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	addr := runTLSServer(t, WithTLS(
+		writeFile(t, dir, "cert.pem", certPEM),
+		writeFile(t, dir, "key.pem", keyPEM),
+	))
+	clientTLS := &tls.Config{RootCAs: ca.pool}
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS}}
+	rsp, err := client.Get("https://" + addr + "/slow")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		t.Errorf("GET /slow = %v, want 200", rsp.StatusCode)
+	}
+
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(credentials.NewTLS(clientTLS)))
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	got, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Check() error = %v", err)
+	}
+	if got.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("Check() = %v, want SERVING", got.Status)
+	}
+}
+
+func TestServer_WithTLSClientAuth(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	certPEM, keyPEM := ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	addr := runTLSServer(t,
+		WithTLS(writeFile(t, dir, "cert.pem", certPEM), writeFile(t, dir, "key.pem", keyPEM)),
+		WithTLSClientAuth(writeFile(t, dir, "ca.pem", ca.pem), tls.RequireAndVerifyClientCert),
+	)
+
+	clientCertPEM, clientKeyPEM := ca.issue(t, "client", x509.ExtKeyUsageClientAuth)
+	clientCert, err := tls.X509KeyPair(clientCertPEM, clientKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		certs   []tls.Certificate
+		wantErr bool
+	}{
+		{"with certificate", []tls.Certificate{clientCert}, false},
+		{"without certificate", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &http.Client{Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: ca.pool, Certificates: tt.certs},
+			}}
+			rsp, err := client.Get("https://" + addr + "/slow")
+			if err == nil {
+				rsp.Body.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_tlsConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	certPEM, keyPEM := ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	certFile := writeFile(t, dir, "cert.pem", certPEM)
+	keyFile := writeFile(t, dir, "key.pem", keyPEM)
+	caFile := writeFile(t, dir, "ca.pem", ca.pem)
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		wantAuth tls.ClientAuthType
+		wantErr  bool
+	}{
+		{"disabled", nil, tls.NoClientCert, false},
+		{"TLS", []Option{WithTLS(certFile, keyFile)}, tls.NoClientCert, false},
+		{"mTLS", []Option{
+			WithTLS(certFile, keyFile),
+			WithTLSClientAuth(caFile, tls.RequireAndVerifyClientCert),
+		}, tls.RequireAndVerifyClientCert, false},
+		{"mTLS with config CAs", []Option{
+			WithTLSConfig(&tls.Config{ClientCAs: ca.pool}),
+			WithTLS(certFile, keyFile),
+			WithTLSClientAuth("", tls.VerifyClientCertIfGiven),
+		}, tls.VerifyClientCertIfGiven, false},
+		{"client auth without TLS", []Option{
+			WithTLSClientAuth(caFile, tls.RequireAndVerifyClientCert),
+		}, 0, true},
+		{"verification without CAs", []Option{
+			WithTLS(certFile, keyFile),
+			WithTLSClientAuth("", tls.RequireAndVerifyClientCert),
+		}, 0, true},
+		{"missing certificate", []Option{WithTLS(filepath.Join(dir, "none.pem"), keyFile)}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := defaultServerOpts(0)
+			for _, opt := range tt.opts {
+				opt(o)
+			}
+			cfg, err := o.tlsConfig()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("tlsConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if cfg != nil && cfg.ClientAuth != tt.wantAuth {
+				t.Errorf("ClientAuth = %v, want %v", cfg.ClientAuth, tt.wantAuth)
+			}
+		})
+	}
+}
+
+func Test_certReloader(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	certPEM, keyPEM := ca.issue(t, "first", x509.ExtKeyUsageServerAuth)
+	certFile := writeFile(t, dir, "cert.pem", certPEM)
+	keyFile := writeFile(t, dir, "key.pem", keyPEM)
+
+	r, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("newCertReloader() error = %v", err)
+	}
+	commonName := func() string {
+		cert, err := r.GetCertificate(nil)
+		if err != nil {
+			t.Fatalf("GetCertificate() error = %v", err)
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return leaf.Subject.CommonName
+	}
+	// modification times may be too coarse to notice the change
+	touch := func(files ...string) {
+		future := time.Now().Add(time.Minute)
+		for _, f := range files {
+			if err := os.Chtimes(f, future, future); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	expire := func() {
+		r.mu.Lock()
+		r.lastCheck = time.Time{}
+		r.mu.Unlock()
+	}
+
+	certPEM, keyPEM = ca.issue(t, "second", x509.ExtKeyUsageServerAuth)
+	writeFile(t, dir, "cert.pem", certPEM)
+	writeFile(t, dir, "key.pem", keyPEM)
+	touch(certFile, keyFile)
+	if got := commonName(); got != "first" {
+		t.Errorf("certificate reloaded before the interval, got %q", got)
+	}
+	expire()
+	if got := commonName(); got != "second" {
+		t.Errorf("certificate after change = %q, want second", got)
+	}
+
+	// the broken files are ignored
+	writeFile(t, dir, "cert.pem", []byte("broken"))
+	touch(certFile)
+	expire()
+	if got := commonName(); got != "second" {
+		t.Errorf("certificate after broken change = %q, want second", got)
+	}
+}
@@ -0,0 +1,65 @@
+package httpclient
+
+import (
+	"github.com/ra9form/yuki/transport/httpruntime"
+)
+
+// Option configures the generated HTTP clients.
+type Option func(*Options)
+
+// Options are the options of the generated HTTP clients.
+type Options struct {
+	// Marshalers is the registry the marshalers are looked up in,
+	// httpruntime.DefaultRegistry is used if nil.
+	Marshalers *httpruntime.MarshalerRegistry
+	// ContentType selects the marshaler of the requests and the accepted
+	// responses, the registry's default one is used if empty.
+	ContentType string
+}
+
+// NewOptions applies the options.
+func NewOptions(opts ...Option) Options {
+	var ret Options
+	for _, o := range opts {
+		o(&ret)
+	}
+	return ret
+}
+
+// WithMarshalers sets up the registry the marshalers are looked up in.
+func WithMarshalers(r *httpruntime.MarshalerRegistry) Option {
+	return func(o *Options) {
+		o.Marshalers = r
+	}
+}
+
+// WithContentType makes the client send and accept the content type,
+// e.g. httpruntime.ContentTypeProtobuf to save bandwidth.
+// The marshaler is looked up in the registry, see WithMarshalers.
+// The protobuf marshalers support only the bindings whose bodies
+// are messages.
+func WithContentType(contentType string) Option {
+	return func(o *Options) {
+		o.ContentType = contentType
+	}
+}
+
+// MarshalerRegistry returns the registry to look the marshalers up in.
+func (o Options) MarshalerRegistry() *httpruntime.MarshalerRegistry {
+	if o.Marshalers != nil {
+		return o.Marshalers
+	}
+	return httpruntime.DefaultRegistry
+}
+
+// Marshaler returns the marshaler of the ContentType, or the registry's
+// default one if it is not set or not registered.
+func (o Options) Marshaler() httpruntime.Marshaler {
+	reg := o.MarshalerRegistry()
+	if o.ContentType != "" {
+		if m, ok := reg.Lookup(o.ContentType, nil); ok {
+			return m
+		}
+	}
+	return reg.Default(nil)
+}
@@ -7,6 +7,9 @@ import (
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
+
+	"github.com/ra9form/yuki/transport/requestid"
+	"github.com/ra9form/yuki/transport/tracing"
 )
 
 // RequestMiddleware processes HTTP requests and responses vs provided ClientOptions.
@@ -81,7 +84,11 @@ type RequestMutator func(*http.Request) (*http.Request, error)
 type ResponseMutator func(*http.Response) (*http.Response, error)
 
 // DefaultRequestMutators are used for every outgoing request.
-var DefaultRequestMutators = []RequestMutator{clientReqHeadersFromMD()}
+var DefaultRequestMutators = []RequestMutator{
+	clientReqHeadersFromMD(),
+	clientReqTraceContext(),
+	clientReqRequestID(),
+}
 
 // DefaultResponseMutators are used for every received response.
 var DefaultResponseMutators = []ResponseMutator{}
@@ -115,3 +122,22 @@ func clientReqHeadersFromMD() RequestMutator {
 		return req, nil
 	}
 }
+
+// clientReqTraceContext propagates the context's tracing span via
+// the W3C Trace Context headers.
+func clientReqTraceContext() RequestMutator {
+	return func(req *http.Request) (*http.Request, error) {
+		tracing.InjectHTTP(req.Context(), req.Header)
+		return req, nil
+	}
+}
+
+// clientReqRequestID forwards the context's request ID.
+func clientReqRequestID() RequestMutator {
+	return func(req *http.Request) (*http.Request, error) {
+		if id, ok := requestid.FromContext(req.Context()); ok && req.Header.Get(requestid.Header) == "" {
+			req.Header.Set(requestid.Header, id)
+		}
+		return req, nil
+	}
+}
@@ -0,0 +1,42 @@
+package httpclient
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ra9form/yuki/transport/requestid"
+)
+
+func TestRequestMiddleware_requestID(t *testing.T) {
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		header string
+		want   string
+	}{
+		{"forwarded", requestid.NewContext(context.Background(), "42"), "", "42"},
+		{"explicit header", requestid.NewContext(context.Background(), "42"), "43", "43"},
+		{"none", context.Background(), "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw, err := NewMiddlewareGRPC(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest("GET", "/", nil).WithContext(tt.ctx)
+			if tt.header != "" {
+				r.Header.Set(requestid.Header, tt.header)
+			}
+
+			r, err = mw.ProcessRequest(r)
+			if err != nil {
+				t.Fatalf("ProcessRequest() error = %v", err)
+			}
+			if got := r.Header.Get(requestid.Header); got != tt.want {
+				t.Errorf("%v = %q, want %q", requestid.Header, got, tt.want)
+			}
+		})
+	}
+}
@@ -23,6 +23,9 @@ func DefaultSetError(ctx context.Context, req *http.Request, w http.ResponseWrit
 	if grpcErr, ok := err.(interface{ GRPCStatus() *status.Status }); ok {
 		errCode = runtime.HTTPStatusFromCode(grpcErr.GRPCStatus().Code())
 	}
+	if code := httpStatus(err); code != 0 {
+		errCode = code
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(errCode)
 	enc := json.NewEncoder(w)
@@ -14,8 +14,10 @@ import (
 // DefaultChain is a chain that gets applied to the generated handlers.
 func DefaultChain(next http.HandlerFunc) http.HandlerFunc {
 	return InjectTransportStream(
-		HeadersToGRPCMD(
-			next,
+		InjectPeer(
+			HeadersToGRPCMD(
+				next,
+			),
 		),
 	)
 }
@@ -0,0 +1,69 @@
+package httpmw
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// InjectPeer inserts the gRPC peer.Peer to the context, as if the request
+// was received via gRPC.
+// Peer's AuthInfo is credentials.TLSInfo if the request came over TLS.
+func InjectPeer(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		// Use existing peer if it was injected earlier
+		if _, ok := peer.FromContext(ctx); ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		p := &peer.Peer{Addr: remoteAddr(r.RemoteAddr)}
+		if r.TLS != nil {
+			p.AuthInfo = credentials.TLSInfo{
+				State:          *r.TLS,
+				CommonAuthInfo: credentials.CommonAuthInfo{SecurityLevel: credentials.PrivacyAndIntegrity},
+			}
+		}
+
+		ctx = peer.NewContext(ctx, p)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// remoteAddr converts http.Request.RemoteAddr to net.Addr.
+// Addresses of the Unix sockets are paths, abstract names starting
+// with '@' or empty for the unnamed clients.
+func remoteAddr(addr string) net.Addr {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		if strings.HasPrefix(addr, "/") || strings.HasPrefix(addr, "@") {
+			return &net.UnixAddr{Name: addr, Net: "unix"}
+		}
+		return strAddr(addr)
+	}
+	ip := net.ParseIP(host)
+	nport, err := strconv.Atoi(port)
+	if ip == nil || err != nil {
+		return strAddr(addr)
+	}
+	return &net.TCPAddr{IP: ip, Port: nport}
+}
+
+// strAddr is a net.Addr which can't be parsed as TCP or Unix address.
+type strAddr string
+
+// Network returns "tcp" for host:port addresses with a non-IP host
+// or a named port, empty string otherwise.
+func (a strAddr) Network() string {
+	if _, _, err := net.SplitHostPort(string(a)); err != nil {
+		return ""
+	}
+	return "tcp"
+}
+
+func (a strAddr) String() string { return string(a) }
@@ -0,0 +1,25 @@
+package httpmw
+
+import "testing"
+
+func Test_remoteAddr(t *testing.T) {
+	tests := []struct {
+		addr    string
+		network string
+		str     string
+	}{
+		{"127.0.0.1:8080", "tcp", "127.0.0.1:8080"},
+		{"[::1]:8080", "tcp", "[::1]:8080"},
+		{"localhost:http", "tcp", "localhost:http"},
+		{"/run/app.sock", "unix", "/run/app.sock"},
+		{"@app", "unix", "@app"},
+		{"pipe", "", "pipe"},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		got := remoteAddr(tt.addr)
+		if got.Network() != tt.network || got.String() != tt.str {
+			t.Errorf("remoteAddr(%q) = %v %q, want %v %q", tt.addr, got.Network(), got, tt.network, tt.str)
+		}
+	}
+}
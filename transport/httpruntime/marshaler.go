@@ -2,9 +2,7 @@ package httpruntime
 
 import (
 	"io"
-	"mime"
 	"net/http"
-	"strings"
 )
 
 // Marshaler is a processor that can marshal and unmarshal data to some content-type.
@@ -21,45 +19,41 @@ type marshalGetterFunc = func(ContentTypeOptions) Marshaler
 // headers.
 type ContentTypeOptions map[string]string
 
-// OverrideMarshaler replaces Marshaler for given content-type.
+// OverrideMarshaler replaces Marshaler for given content-type
+// in the DefaultRegistry.
 func OverrideMarshaler(contentType string, m Marshaler) {
-	marshalDict[strings.ToLower(contentType)] = func(ContentTypeOptions) Marshaler { return m }
+	DefaultRegistry.Override(contentType, m)
 }
 
-// OverrideParametrizedMarshaler replaces MarshalGetter for given content-type.
+// OverrideParametrizedMarshaler replaces MarshalGetter for given content-type
+// in the DefaultRegistry.
 // Use it if your marshaler needs ContentTypeOptions to successfully unmarshal the request.
 func OverrideParametrizedMarshaler(contentType string, f func(ContentTypeOptions) Marshaler) {
-	marshalDict[strings.ToLower(contentType)] = f
+	DefaultRegistry.OverrideParametrized(contentType, f)
 }
 
-// MarshalerForRequest returns marshalers for inbound and outbound bodies.
+// MarshalerForRequest returns marshalers for inbound and outbound bodies
+// from the DefaultRegistry, see MarshalerRegistry.ForRequest.
 func MarshalerForRequest(r *http.Request) (Marshaler, Marshaler) {
-	ctype, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
-	inbound := marshalerOrDefault(ctype, params)
-
-	accept, aparams, _ := mime.ParseMediaType(r.Header.Get("Accept"))
-	outbound := marshalerOrDefault(accept, aparams)
-	return inbound, outbound
+	return DefaultRegistry.ForRequest(r)
 }
 
-func marshalerOrDefault(t string, params map[string]string) Marshaler {
-	t = strings.ToLower(t)
+// InboundMarshaler returns the DefaultRegistry's marshaler for
+// the request's Content-Type, see MarshalerRegistry.Inbound.
+func InboundMarshaler(r *http.Request) (Marshaler, error) {
+	return DefaultRegistry.Inbound(r)
+}
 
-	if m, ok := marshalDict[t]; ok {
-		return m(params)
-	}
-	return DefaultMarshaler(params)
+// OutboundMarshaler negotiates the DefaultRegistry's marshaler of
+// the response, see MarshalerRegistry.Outbound.
+func OutboundMarshaler(r *http.Request) (Marshaler, error) {
+	return DefaultRegistry.Outbound(r)
 }
 
 var defaultMIME = MarshalerPbJSON{}.ContentType()
 
-// DefaultMarshaler returns a default marshaler for the platform.
+// DefaultMarshaler returns a default marshaler for the platform
+// from the DefaultRegistry.
 func DefaultMarshaler(params map[string]string) Marshaler {
-	return marshalDict[defaultMIME](params)
-}
-
-var marshalDict = map[string]marshalGetterFunc{
-	"application/json": func(_ ContentTypeOptions) Marshaler {
-		return mpbjson
-	},
+	return DefaultRegistry.Default(params)
 }
@@ -2,16 +2,101 @@ package httpruntime
 
 import (
 	"io"
+	"strconv"
+	"strings"
 
 	gogojsonpb "github.com/gogo/protobuf/jsonpb"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/protobuf/encoding/protojson"
 )
 
-var mpbjson = MarshalerPbJSON{
-	Marshaler:       &runtime.JSONPb{},
-	Unmarshaler:     &runtime.JSONPb{},
-	GogoMarshaler:   &gogojsonpb.Marshaler{},
-	GogoUnmarshaler: &gogojsonpb.Unmarshaler{},
+// JSONOptions configure MarshalerPbJSON.
+type JSONOptions struct {
+	// EmitUnpopulated outputs the fields with the default values.
+	EmitUnpopulated bool
+	// UseProtoNames outputs the fields' names from the .proto files
+	// instead of lowerCamelCase.
+	UseProtoNames bool
+	// UseEnumNumbers outputs the enums as numbers.
+	UseEnumNumbers bool
+	// DiscardUnknown ignores the unknown fields of the requests.
+	DiscardUnknown bool
+	// Indent indents the output, it's compact if empty.
+	Indent string
+}
+
+// Media type parameters of application/json overriding JSONOptions
+// per request, e.g. "Accept: application/json; emit_defaults=true; pretty=true".
+// The values are parsed by strconv.ParseBool, malformed ones are ignored.
+// DiscardUnknown can't be overridden by the clients.
+const (
+	JSONParamEmitDefaults = "emit_defaults"
+	JSONParamProtoNames   = "proto_names"
+	JSONParamEnumsAsInts  = "enums_as_ints"
+	// JSONParamPretty indents the output with two spaces.
+	JSONParamPretty = "pretty"
+)
+
+// WithParams returns the options overridden by the media type parameters.
+func (o JSONOptions) WithParams(params ContentTypeOptions) JSONOptions {
+	for k, v := range params {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			continue
+		}
+		switch strings.ToLower(k) {
+		case JSONParamEmitDefaults:
+			o.EmitUnpopulated = b
+		case JSONParamProtoNames:
+			o.UseProtoNames = b
+		case JSONParamEnumsAsInts:
+			o.UseEnumNumbers = b
+		case JSONParamPretty:
+			o.Indent = ""
+			if b {
+				o.Indent = "  "
+			}
+		}
+	}
+	return o
+}
+
+// NewMarshalerPbJSON returns the JSON marshaler configured by the options.
+func NewMarshalerPbJSON(o JSONOptions) MarshalerPbJSON {
+	jsonpb := &runtime.JSONPb{
+		MarshalOptions: protojson.MarshalOptions{
+			EmitUnpopulated: o.EmitUnpopulated,
+			UseProtoNames:   o.UseProtoNames,
+			UseEnumNumbers:  o.UseEnumNumbers,
+			Indent:          o.Indent,
+			Multiline:       o.Indent != "",
+		},
+		UnmarshalOptions: protojson.UnmarshalOptions{
+			DiscardUnknown: o.DiscardUnknown,
+		},
+	}
+	return MarshalerPbJSON{
+		Marshaler:       jsonpb,
+		Unmarshaler:     jsonpb,
+		GogoMarshaler:   &gogojsonpb.Marshaler{},
+		GogoUnmarshaler: &gogojsonpb.Unmarshaler{},
+	}
+}
+
+// jsonMarshalerGetter returns the JSON marshalers configured by the options
+// and the media type parameters.
+func jsonMarshalerGetter(o JSONOptions) marshalGetterFunc {
+	base := NewMarshalerPbJSON(o)
+	return func(params ContentTypeOptions) Marshaler {
+		if len(params) == 0 {
+			return base
+		}
+		po := o.WithParams(params)
+		if po == o {
+			return base
+		}
+		return NewMarshalerPbJSON(po)
+	}
 }
 
 // MarshalerPbJSON (un)marshals between JSON and proto.Messages.
@@ -36,3 +121,12 @@ func (m MarshalerPbJSON) Marshal(w io.Writer, src interface{}) error {
 	// removed gogo support as it is incompatible with protobuf-v2
 	return m.Marshaler.NewEncoder(w).Encode(src)
 }
+
+// DiscardingUnknown returns the copy of the marshaler ignoring
+// the unknown fields of the requests.
+func (m MarshalerPbJSON) DiscardingUnknown() MarshalerPbJSON {
+	u := *m.Unmarshaler
+	u.DiscardUnknown = true
+	m.Unmarshaler = &u
+	return m
+}
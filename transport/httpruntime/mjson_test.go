@@ -0,0 +1,84 @@
+package httpruntime
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/typepb"
+)
+
+func TestMarshalerRegistry_WithJSONOptions(t *testing.T) {
+	reg := NewMarshalerRegistry().WithJSONOptions(JSONOptions{UseProtoNames: true})
+	msg := &typepb.Field{Name: "id", TypeUrl: "t"}
+
+	// protojson adds random spaces, so want is matched without them
+	tests := []struct {
+		accept string
+		want   []string
+		absent []string
+		pretty bool
+	}{
+		{"application/json", []string{`"type_url":"t"`}, []string{`"number"`}, false},
+		{"application/json; emit_defaults=true; enums_as_ints=1", []string{`"number":0`, `"kind":0`}, nil, false},
+		{"application/json; pretty=true; proto_names=false", []string{`"typeUrl":"t"`}, nil, true},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", tt.accept)
+		m, err := reg.Outbound(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := m.Marshal(&buf, msg); err != nil {
+			t.Fatal(err)
+		}
+		out := strings.TrimSpace(buf.String())
+		compact := strings.Join(strings.Fields(out), "")
+		for _, s := range tt.want {
+			if !strings.Contains(compact, s) {
+				t.Errorf("%q: %s doesn't contain %s", tt.accept, out, s)
+			}
+		}
+		for _, s := range tt.absent {
+			if strings.Contains(out, s) {
+				t.Errorf("%q: %s contains %q", tt.accept, out, s)
+			}
+		}
+		if got := strings.Contains(out, "\n"); got != tt.pretty {
+			t.Errorf("%q: %s is multiline %v, want %v", tt.accept, out, got, tt.pretty)
+		}
+	}
+
+	if _, ok := reg.Lookup(ContentTypeProtobuf, nil); !ok {
+		t.Error("parent's marshalers are not used")
+	}
+}
+
+func TestMarshalerRegistry_RemoveJSON(t *testing.T) {
+	reg := NewMarshalerRegistry().WithJSONOptions(JSONOptions{UseProtoNames: true})
+	reg.Override("application/json", testMarshaler{ctype: "application/json"})
+	reg.Remove("application/json")
+
+	var buf bytes.Buffer
+	if err := reg.Default(nil).Marshal(&buf, &typepb.Field{TypeUrl: "t"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"type_url"`) {
+		t.Errorf("JSON marshaler isn't reset to the registry's options: %s", buf.String())
+	}
+}
+
+func TestMarshalerRegistry_DiscardUnknownParam(t *testing.T) {
+	r := httptest.NewRequest("POST", "/", nil)
+	r.Header.Set("Content-Type", "application/json; discard_unknown=true")
+	m, err := NewMarshalerRegistry().Inbound(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Unmarshal(strings.NewReader(`{"typo":1}`), &typepb.Field{}); err == nil {
+		t.Error("unknown fields are discarded by the request's parameter")
+	}
+}
@@ -0,0 +1,129 @@
+package httpruntime
+
+import (
+	"io"
+	"io/ioutil"
+	"reflect"
+
+	protov1 "github.com/golang/protobuf/proto"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/runtime/protoiface"
+)
+
+// Content types of the protobuf marshalers.
+const (
+	ContentTypeProtobuf    = "application/x-protobuf"
+	ContentTypeProtobufAlt = "application/protobuf"
+	ContentTypeProtoText   = "text/plain"
+)
+
+// MarshalerPbBinary (un)marshals between the protobuf wire format and
+// proto.Messages.
+// Only messages are supported, so it fails for the bindings whose body
+// is a scalar or a repeated field.
+type MarshalerPbBinary struct {
+	// MediaType is returned by ContentType, ContentTypeProtobuf if empty.
+	MediaType string
+}
+
+func (m MarshalerPbBinary) ContentType() string {
+	if m.MediaType != "" {
+		return m.MediaType
+	}
+	return ContentTypeProtobuf
+}
+
+func (MarshalerPbBinary) Unmarshal(r io.Reader, dst interface{}) error {
+	msg, err := AsProtoMessage(dst)
+	if err != nil {
+		return err
+	}
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(buf, msg)
+}
+
+func (MarshalerPbBinary) Marshal(w io.Writer, src interface{}) error {
+	msg, err := AsProtoMessage(src)
+	if err != nil {
+		return err
+	}
+	buf, err := proto.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+// MarshalerPbText (un)marshals between the protobuf text format and
+// proto.Messages. It is meant for debugging, the format is not stable.
+// Only messages are supported, see MarshalerPbBinary.
+//
+// It is not registered by default, since clients sending or accepting
+// text/plain don't expect the text format; register it explicitly:
+//
+//	reg.Override(httpruntime.ContentTypeProtoText, httpruntime.MarshalerPbText{})
+type MarshalerPbText struct {
+	Marshaler   prototext.MarshalOptions
+	Unmarshaler prototext.UnmarshalOptions
+}
+
+func (MarshalerPbText) ContentType() string {
+	return ContentTypeProtoText
+}
+
+func (m MarshalerPbText) Unmarshal(r io.Reader, dst interface{}) error {
+	msg, err := AsProtoMessage(dst)
+	if err != nil {
+		return err
+	}
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return m.Unmarshaler.Unmarshal(buf, msg)
+}
+
+func (m MarshalerPbText) Marshal(w io.Writer, src interface{}) error {
+	msg, err := AsProtoMessage(src)
+	if err != nil {
+		return err
+	}
+	buf, err := m.Marshaler.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+// AsProtoMessage converts the messages generated by both APIv1 and APIv2
+// to proto.Message.
+// Pointers to message pointers are dereferenced, allocating the messages
+// if nil, as the generated handlers unmarshal the bodies into them.
+func AsProtoMessage(v interface{}) (proto.Message, error) {
+	switch m := v.(type) {
+	case proto.Message:
+		return m, nil
+	case protoiface.MessageV1:
+		return protov1.MessageV2(m), nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() && rv.Elem().Kind() == reflect.Ptr {
+		elem := rv.Elem()
+		if elem.IsNil() {
+			elem = reflect.New(elem.Type().Elem())
+		}
+		if m, err := AsProtoMessage(elem.Interface()); err == nil {
+			rv.Elem().Set(elem)
+			return m, nil
+		}
+	}
+	return nil, errors.Errorf("%T is not a protobuf message", v)
+}
@@ -0,0 +1,30 @@
+package httpruntime
+
+import (
+	"bytes"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestProtoMarshalers(t *testing.T) {
+	in := &descriptorpb.FieldDescriptorProto{Name: proto.String("id"), Number: proto.Int32(1)}
+	for _, m := range []Marshaler{MarshalerPbBinary{}, MarshalerPbText{}} {
+		var buf bytes.Buffer
+		if err := m.Marshal(&buf, in); err != nil {
+			t.Fatalf("%v: Marshal() error = %v", m.ContentType(), err)
+		}
+		var out *descriptorpb.FieldDescriptorProto
+		if err := m.Unmarshal(&buf, &out); err != nil {
+			t.Fatalf("%v: Unmarshal() error = %v", m.ContentType(), err)
+		}
+		if !proto.Equal(in, out) {
+			t.Errorf("%v: got %v, want %v", m.ContentType(), out, in)
+		}
+
+		if err := m.Marshal(&buf, []string{"a"}); err == nil {
+			t.Errorf("%v: Marshal() succeeded for []string", m.ContentType())
+		}
+	}
+}
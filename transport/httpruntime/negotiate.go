@@ -0,0 +1,138 @@
+package httpruntime
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MediaTypeError is returned if no registered marshaler can read the request
+// or write the response.
+type MediaTypeError struct {
+	// Status is http.StatusUnsupportedMediaType or http.StatusNotAcceptable.
+	Status int
+	// MediaType is the offending Content-Type or Accept header.
+	MediaType string
+}
+
+func (e MediaTypeError) Error() string {
+	if e.Status == http.StatusNotAcceptable {
+		return fmt.Sprintf("none of the accepted media types %q is supported", e.MediaType)
+	}
+	return fmt.Sprintf("unsupported media type %q", e.MediaType)
+}
+
+// HTTPStatus returns the status code of the response.
+func (e MediaTypeError) HTTPStatus() int {
+	return e.Status
+}
+
+// GRPCStatus reports the error as InvalidArgument.
+func (e MediaTypeError) GRPCStatus() *status.Status {
+	return status.New(codes.InvalidArgument, e.Error())
+}
+
+// httpStatus returns the HTTP status code of the error or its cause.
+// The code set by HTTPStatus takes precedence over the gRPC status.
+func httpStatus(err error) int {
+	if h, ok := err.(interface{ HTTPStatus() int }); ok {
+		return h.HTTPStatus()
+	}
+	if h, ok := errors.Cause(err).(interface{ HTTPStatus() int }); ok {
+		return h.HTTPStatus()
+	}
+	return 0
+}
+
+// mediaRange is an element of the Accept header.
+type mediaRange struct {
+	mediaType string
+	params    ContentTypeOptions
+	q         float64
+}
+
+// specificity ranks "type/subtype" over "type/*" over "*/*".
+func (m mediaRange) specificity() int {
+	switch {
+	case m.mediaType == "*/*":
+		return 0
+	case strings.HasSuffix(m.mediaType, "/*"):
+		return 1
+	}
+	return 2
+}
+
+// matches returns true if the media type is in the range.
+func (m mediaRange) matches(mediaType string) bool {
+	switch m.specificity() {
+	case 0:
+		return true
+	case 1:
+		return strings.HasPrefix(mediaType, strings.TrimSuffix(m.mediaType, "*"))
+	}
+	return m.mediaType == mediaType
+}
+
+// parseAccept returns the acceptable media ranges, the preferred first,
+// and the refused ones, i.e. with q=0.
+// Malformed ranges are skipped.
+func parseAccept(header string) (accepted, refused []mediaRange) {
+	for _, s := range strings.Split(header, ",") {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		mtype, params, err := mime.ParseMediaType(s)
+		if err != nil {
+			continue
+		}
+		rng := mediaRange{mediaType: strings.ToLower(mtype), params: params, q: 1}
+		if q, ok := params["q"]; ok {
+			rng.q, err = strconv.ParseFloat(q, 64)
+			if err != nil || rng.q < 0 || rng.q > 1 {
+				continue
+			}
+			delete(params, "q")
+		}
+		if rng.q == 0 {
+			refused = append(refused, rng)
+			continue
+		}
+		accepted = append(accepted, rng)
+	}
+
+	sort.SliceStable(accepted, func(i, j int) bool {
+		if accepted[i].q != accepted[j].q {
+			return accepted[i].q > accepted[j].q
+		}
+		return accepted[i].specificity() > accepted[j].specificity()
+	})
+	return accepted, refused
+}
+
+// isRefused returns true if the most specific range matching the media
+// type is refused, e.g. application/json is refused by
+// "application/json;q=0, */*", but not by "application/*;q=0, application/json".
+func isRefused(mediaType string, accepted, refused []mediaRange) bool {
+	best := -1
+	for _, rng := range refused {
+		if rng.matches(mediaType) && rng.specificity() > best {
+			best = rng.specificity()
+		}
+	}
+	if best < 0 {
+		return false
+	}
+	for _, rng := range accepted {
+		if rng.matches(mediaType) && rng.specificity() > best {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,241 @@
+package httpruntime
+
+import (
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultRegistry is used by the package-level functions and by
+// the ServiceDescs and HTTP clients that don't have their own registry.
+var DefaultRegistry = NewMarshalerRegistry()
+
+// MarshalerRegistry holds the marshalers by their content types.
+// It is safe for concurrent use.
+type MarshalerRegistry struct {
+	mu   sync.RWMutex
+	dict map[string]marshalGetterFunc
+	// parent is looked up for the content types missing in dict.
+	parent *MarshalerRegistry
+	// json is the JSON marshaler the registry was created with,
+	// Remove restores it.
+	json marshalGetterFunc
+	// strict is set by RejectUnknownContentTypes.
+	strict bool
+}
+
+// NewMarshalerRegistry returns the registry with the default marshalers:
+// JSON and protobuf binary (application/x-protobuf and application/protobuf).
+// The protobuf text format is not registered, see MarshalerPbText.
+func NewMarshalerRegistry() *MarshalerRegistry {
+	json := jsonMarshalerGetter(JSONOptions{})
+	return &MarshalerRegistry{
+		json: json,
+		dict: map[string]marshalGetterFunc{
+			defaultMIME: json,
+			ContentTypeProtobuf: func(_ ContentTypeOptions) Marshaler {
+				return MarshalerPbBinary{MediaType: ContentTypeProtobuf}
+			},
+			ContentTypeProtobufAlt: func(_ ContentTypeOptions) Marshaler {
+				return MarshalerPbBinary{MediaType: ContentTypeProtobufAlt}
+			},
+		},
+	}
+}
+
+// WithJSONOptions returns the registry using the JSON marshaler configured
+// by the options. The other marshalers are looked up in r, including
+// the ones registered later.
+func (r *MarshalerRegistry) WithJSONOptions(o JSONOptions) *MarshalerRegistry {
+	json := jsonMarshalerGetter(o)
+	return &MarshalerRegistry{
+		dict:   map[string]marshalGetterFunc{defaultMIME: json},
+		parent: r,
+		json:   json,
+	}
+}
+
+// Override replaces Marshaler for given content-type.
+func (r *MarshalerRegistry) Override(contentType string, m Marshaler) {
+	r.OverrideParametrized(contentType, func(ContentTypeOptions) Marshaler { return m })
+}
+
+// OverrideParametrized replaces MarshalGetter for given content-type.
+// Use it if your marshaler needs ContentTypeOptions to successfully unmarshal the request.
+func (r *MarshalerRegistry) OverrideParametrized(contentType string, f func(ContentTypeOptions) Marshaler) {
+	r.mu.Lock()
+	r.dict[strings.ToLower(contentType)] = f
+	r.mu.Unlock()
+}
+
+// Remove removes the marshaler of the content-type, e.g. to disable
+// one of the default marshalers.
+// The default JSON marshaler can't be removed, it is reset to the one
+// the registry was created with instead, e.g. by WithJSONOptions.
+// The marshalers of the registry WithJSONOptions was called on are
+// not affected.
+func (r *MarshalerRegistry) Remove(contentType string) {
+	contentType = strings.ToLower(contentType)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if contentType == defaultMIME {
+		r.dict[defaultMIME] = r.json
+		return
+	}
+	delete(r.dict, contentType)
+}
+
+// RejectUnknownContentTypes makes Inbound report the unregistered and
+// malformed Content-Types with 415.
+// By default, such request bodies are decoded by the default marshaler,
+// since some clients send JSON with other Content-Types, e.g. curl -d
+// (application/x-www-form-urlencoded) or fetch with a string body
+// (text/plain).
+// The registries created by WithJSONOptions inherit the setting.
+func (r *MarshalerRegistry) RejectUnknownContentTypes() {
+	r.mu.Lock()
+	r.strict = true
+	r.mu.Unlock()
+}
+
+// Lookup returns the marshaler of the content-type.
+func (r *MarshalerRegistry) Lookup(contentType string, params ContentTypeOptions) (Marshaler, bool) {
+	f, ok := r.lookup(strings.ToLower(contentType))
+	if !ok {
+		return nil, false
+	}
+	return f(params), true
+}
+
+// Default returns the default marshaler of the registry.
+func (r *MarshalerRegistry) Default(params map[string]string) Marshaler {
+	f, _ := r.lookup(defaultMIME)
+	return f(params)
+}
+
+// ForRequest returns marshalers for inbound and outbound bodies.
+// The default marshaler is used for the unsupported media types,
+// see Inbound and Outbound to report them.
+func (r *MarshalerRegistry) ForRequest(req *http.Request) (Marshaler, Marshaler) {
+	inbound, err := r.Inbound(req)
+	if err != nil {
+		_, params, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		inbound = r.Default(params)
+	}
+	outbound, err := r.Outbound(req)
+	if err != nil {
+		outbound = r.Default(nil)
+	}
+	return inbound, outbound
+}
+
+// Inbound returns the marshaler for the request's Content-Type.
+// The default marshaler is used if the Content-Type is not set or is
+// unknown. MediaTypeError with 415 is returned for unknown Content-Types
+// if the registry rejects them, see RejectUnknownContentTypes.
+func (r *MarshalerRegistry) Inbound(req *http.Request) (Marshaler, error) {
+	header := req.Header.Get("Content-Type")
+	if header == "" {
+		return r.Default(nil), nil
+	}
+	ctype, params, err := mime.ParseMediaType(header)
+	if err != nil {
+		if r.rejectsUnknown() {
+			return nil, MediaTypeError{Status: http.StatusUnsupportedMediaType, MediaType: header}
+		}
+		return r.Default(params), nil
+	}
+	f, ok := r.lookup(strings.ToLower(ctype))
+	if !ok {
+		if r.rejectsUnknown() {
+			return nil, MediaTypeError{Status: http.StatusUnsupportedMediaType, MediaType: header}
+		}
+		return r.Default(params), nil
+	}
+	return f(params), nil
+}
+
+// Outbound negotiates the marshaler of the response by
+// the request's Accept header.
+// The media ranges are tried in the order of their q-values, wildcards
+// match the default marshaler first, except for the media types refused
+// by q=0. The default marshaler is used if Accept is not set.
+// MediaTypeError with 406 is returned if nothing acceptable is registered.
+func (r *MarshalerRegistry) Outbound(req *http.Request) (Marshaler, error) {
+	header := strings.Join(req.Header.Values("Accept"), ",")
+	if strings.TrimSpace(header) == "" {
+		return r.Default(nil), nil
+	}
+
+	accepted, refused := parseAccept(header)
+	acceptable := func(t string) bool {
+		return !isRefused(t, accepted, refused)
+	}
+	for _, rng := range accepted {
+		if m, ok := r.forRange(rng, acceptable); ok {
+			return m, nil
+		}
+	}
+	return nil, MediaTypeError{Status: http.StatusNotAcceptable, MediaType: header}
+}
+
+func (r *MarshalerRegistry) lookup(contentType string) (marshalGetterFunc, bool) {
+	r.mu.RLock()
+	f, ok := r.dict[contentType]
+	r.mu.RUnlock()
+	if !ok && r.parent != nil {
+		return r.parent.lookup(contentType)
+	}
+	return f, ok
+}
+
+func (r *MarshalerRegistry) rejectsUnknown() bool {
+	r.mu.RLock()
+	strict := r.strict
+	r.mu.RUnlock()
+	if !strict && r.parent != nil {
+		return r.parent.rejectsUnknown()
+	}
+	return strict
+}
+
+// types returns the registered content types, sorted.
+func (r *MarshalerRegistry) types() []string {
+	var ret []string
+	if r.parent != nil {
+		ret = r.parent.types()
+	}
+	r.mu.RLock()
+	for t := range r.dict {
+		ret = append(ret, t)
+	}
+	r.mu.RUnlock()
+	sort.Strings(ret)
+	return ret
+}
+
+// forRange returns the marshaler matching the media range, skipping
+// the media types that are not acceptable.
+func (r *MarshalerRegistry) forRange(rng mediaRange, acceptable func(string) bool) (Marshaler, bool) {
+	if rng.specificity() == 2 {
+		if f, ok := r.lookup(rng.mediaType); ok && acceptable(rng.mediaType) {
+			return f(rng.params), true
+		}
+		return nil, false
+	}
+
+	if rng.matches(defaultMIME) && acceptable(defaultMIME) {
+		return r.Default(rng.params), true
+	}
+	for _, t := range r.types() {
+		if !rng.matches(t) || !acceptable(t) {
+			continue
+		}
+		if f, ok := r.lookup(t); ok {
+			return f(rng.params), true
+		}
+	}
+	return nil, false
+}
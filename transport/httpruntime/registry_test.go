@@ -0,0 +1,96 @@
+package httpruntime
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testMarshaler struct {
+	Marshaler
+	ctype string
+}
+
+func (m testMarshaler) ContentType() string {
+	return m.ctype
+}
+
+func TestMarshalerRegistry_Outbound(t *testing.T) {
+	reg := NewMarshalerRegistry()
+	reg.Override(ContentTypeProtoText, MarshalerPbText{})
+	reg.Override("text/x-test", testMarshaler{ctype: "text/x-test"})
+
+	tests := []struct {
+		accept string
+		want   string
+		status int
+	}{
+		{"", "application/json", 0},
+		{"text/html,application/json;q=0.9,*/*;q=0.8", "application/json", 0},
+		{"application/json;q=0.5, text/x-test", "text/x-test", 0},
+		{"text/*", "text/plain", 0},
+		{"application/protobuf, application/json;q=0.9", "application/protobuf", 0},
+		{"text/html, */*;q=0.1", "application/json", 0},
+		{"application/json;q=0, text/html", "", http.StatusNotAcceptable},
+		{"application/json;q=0, */*", "application/protobuf", 0},
+		{"application/*;q=0, */*", "text/plain", 0},
+		{"application/*;q=0, application/json;q=0.5, */*", "application/json", 0},
+		{"text/plain;q=0, text/*", "text/x-test", 0},
+		{"*/*;q=0", "", http.StatusNotAcceptable},
+		{"image/png", "", http.StatusNotAcceptable},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		m, err := reg.Outbound(r)
+		if tt.status != 0 {
+			if httpStatus(err) != tt.status {
+				t.Errorf("Outbound(%q) error = %v, want status %v", tt.accept, err, tt.status)
+			}
+			continue
+		}
+		if err != nil || m.ContentType() != tt.want {
+			t.Errorf("Outbound(%q) = %v, %v, want %v", tt.accept, m, err, tt.want)
+		}
+	}
+}
+
+func TestMarshalerRegistry_Inbound(t *testing.T) {
+	strict := NewMarshalerRegistry()
+	strict.RejectUnknownContentTypes()
+	tests := []struct {
+		ctype           string
+		lenient, strict int
+	}{
+		{"", 0, 0},
+		{"application/json; charset=utf-8", 0, 0},
+		{"application/javascript", 0, http.StatusUnsupportedMediaType},
+		{"text/plain;charset=UTF-8", 0, http.StatusUnsupportedMediaType},
+		{"application/json;;", 0, http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "/", nil)
+		r.Header.Set("Content-Type", tt.ctype)
+		m, err := NewMarshalerRegistry().Inbound(r)
+		if httpStatus(err) != tt.lenient {
+			t.Errorf("Inbound(%q) error = %v, want status %v", tt.ctype, err, tt.lenient)
+		}
+		if err == nil && m.ContentType() != defaultMIME {
+			t.Errorf("Inbound(%q) = %v, want the default marshaler", tt.ctype, m.ContentType())
+		}
+		_, err = strict.WithJSONOptions(JSONOptions{}).Inbound(r)
+		if httpStatus(err) != tt.strict {
+			t.Errorf("strict Inbound(%q) error = %v, want status %v", tt.ctype, err, tt.strict)
+		}
+	}
+}
+
+func TestNewMarshalerRegistry_text(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "text/*")
+	if m, err := NewMarshalerRegistry().Outbound(r); httpStatus(err) != http.StatusNotAcceptable {
+		t.Errorf("Outbound(text/*) = %v, %v, want 406", m, err)
+	}
+}
@@ -0,0 +1,72 @@
+package httpruntime
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// ErrorWriter outputs errors to the client.
+type ErrorWriter func(context.Context, *http.Request, http.ResponseWriter, error)
+
+// StatusErrorWriter outputs the error as the JSON of google.rpc.Status:
+// {"code": 3, "message": "...", "details": [{"@type": "...", ...}]}.
+// The details of the gRPC status, e.g. errdetails.BadRequest, are rendered
+// by protojson, so they must be registered in protoregistry.GlobalTypes.
+// errdetails.RetryInfo sets the Retry-After header.
+// The HTTP status code is mapped from the gRPC code unless the error has
+// the HTTPStatus() int method, e.g. MediaTypeError.
+// The status of the cause is used for the errors wrapped by pkg/errors.
+// Errors that are not gRPC statuses are reported as Unknown.
+func StatusErrorWriter(ctx context.Context, req *http.Request, w http.ResponseWriter, err error) {
+	st := grpcStatus(err)
+
+	buf, merr := protojson.Marshal(st.Proto())
+	if merr != nil {
+		// the details are not known, so only the code and the message are sent
+		buf, _ = protojson.Marshal(status.New(st.Code(), st.Message()).Proto())
+	}
+
+	if d, ok := retryDelay(st); ok {
+		w.Header().Set("Retry-After", strconv.FormatInt(d, 10))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	code := runtime.HTTPStatusFromCode(st.Code())
+	if c := httpStatus(err); c != 0 {
+		code = c
+	}
+	w.WriteHeader(code)
+	w.Write(buf)
+}
+
+// grpcStatus returns the status of the error or, if it has none, of its cause.
+func grpcStatus(err error) *status.Status {
+	if st, ok := status.FromError(err); ok {
+		return st
+	}
+	return status.Convert(errors.Cause(err))
+}
+
+// retryDelay returns the delay of the RetryInfo detail in whole seconds,
+// rounded up.
+func retryDelay(st *status.Status) (int64, bool) {
+	for _, d := range st.Details() {
+		info, ok := d.(*errdetails.RetryInfo)
+		if !ok || info.GetRetryDelay() == nil {
+			continue
+		}
+		secs := math.Ceil(info.GetRetryDelay().AsDuration().Seconds())
+		if secs < 0 {
+			secs = 0
+		}
+		return int64(secs), true
+	}
+	return 0, false
+}
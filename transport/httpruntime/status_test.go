@@ -0,0 +1,62 @@
+package httpruntime
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	pkgerrors "github.com/pkg/errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func TestStatusErrorWriter(t *testing.T) {
+	st, err := status.New(codes.Unavailable, "try later").WithDetails(
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(1500 * time.Millisecond)},
+		&errdetails.ErrorInfo{Reason: "OVERLOADED"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		err        error
+		code       int
+		rpcCode    codes.Code
+		details    int
+		retryAfter string
+	}{
+		{"status", st.Err(), http.StatusServiceUnavailable, codes.Unavailable, 2, "2"},
+		{"plain", errors.New("boom"), http.StatusInternalServerError, codes.Unknown, 0, ""},
+		{"wrapped", pkgerrors.Wrap(st.Err(), "couldn't call"), http.StatusServiceUnavailable, codes.Unavailable, 2, "2"},
+		{"wrapped media type", pkgerrors.WithStack(MediaTypeError{Status: http.StatusNotAcceptable}), http.StatusNotAcceptable, codes.InvalidArgument, 0, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			StatusErrorWriter(context.Background(), httptest.NewRequest("GET", "/", nil), w, tt.err)
+
+			if w.Code != tt.code {
+				t.Errorf("code = %v, want %v", w.Code, tt.code)
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.retryAfter {
+				t.Errorf("Retry-After = %q, want %q", got, tt.retryAfter)
+			}
+			var got spb.Status
+			if err := protojson.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("body %s: %v", w.Body, err)
+			}
+			if codes.Code(got.Code) != tt.rpcCode || len(got.Details) != tt.details {
+				t.Errorf("body = %s, want code %v with %v details", w.Body, tt.rpcCode, tt.details)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package httptransport
+
+import "context"
+
+// Binding is the HTTP binding an RPC method was called through.
+type Binding struct {
+	// Method is the HTTP method, e.g. GET.
+	Method string
+	// Pattern is the path template, e.g. /v1/users/{id}.
+	Pattern string
+}
+
+func (b Binding) String() string {
+	return b.Method + " " + b.Pattern
+}
+
+type bindingKey struct{}
+
+// NewBindingContext returns a context carrying the binding.
+// It is used by the generated HTTP handlers, so the interceptors can
+// tell HTTP-transcoded calls from gRPC ones.
+func NewBindingContext(ctx context.Context, b Binding) context.Context {
+	return context.WithValue(ctx, bindingKey{}, b)
+}
+
+// BindingFromContext returns the binding the call was made through.
+// It returns false for the calls received via gRPC.
+func BindingFromContext(ctx context.Context) (Binding, bool) {
+	b, ok := ctx.Value(bindingKey{}).(Binding)
+	return b, ok
+}
@@ -1,10 +1,42 @@
 package httptransport
 
+import (
+	"fmt"
+	"net/url"
+	"sort"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/utilities"
+	"github.com/pkg/errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/ra9form/yuki/transport/httpruntime"
+)
+
+// Location is the part of the HTTP request a field is read from.
+type Location string
+
+// Locations of the request fields.
+const (
+	LocationPath  Location = "path"
+	LocationQuery Location = "query"
+	LocationBody  Location = "body"
+)
+
 // MarshalerError is returned by a marshaler func.
 // It is used to decorate errors coming from gRPC-generated _Handler
 // to distinguish parser errors from handlers' errors.
 type MarshalerError struct {
 	Err error
+	// Field is the name of the malformed field, empty if unknown
+	// or if the whole body is malformed.
+	Field string
+	// Location is the part of the request the field is read from,
+	// empty if unknown.
+	Location Location
 }
 
 func (m MarshalerError) Cause() error {
@@ -15,6 +47,70 @@ func (m MarshalerError) Error() string {
 	return m.Err.Error()
 }
 
+// GRPCStatus reports the error as InvalidArgument with the BadRequest
+// detail naming the field.
+// The status of Err's cause is used if it has one, e.g. set by
+// httpruntime.TransformUnmarshalerError; the BadRequest detail is appended
+// to it unless it has one already.
+func (m MarshalerError) GRPCStatus() *status.Status {
+	st := status.New(codes.InvalidArgument, m.Error())
+	if s, ok := errors.Cause(m.Err).(interface{ GRPCStatus() *status.Status }); ok {
+		st = s.GRPCStatus()
+		if m.Field == "" || hasBadRequest(st) {
+			return st
+		}
+	}
+
+	desc := m.Error()
+	if m.Location != "" {
+		desc = fmt.Sprintf("invalid %v: %v", m.Location, desc)
+	}
+	withDetails, err := st.WithDetails(&errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{{
+			Field:       m.Field,
+			Description: desc,
+		}},
+	})
+	if err != nil {
+		return st
+	}
+	return withDetails
+}
+
+func hasBadRequest(st *status.Status) bool {
+	for _, d := range st.Details() {
+		if _, ok := d.(*errdetails.BadRequest); ok {
+			return true
+		}
+	}
+	return false
+}
+
 func NewMarshalerError(err error) MarshalerError {
 	return MarshalerError{Err: err}
 }
+
+// NewFieldError returns the error of the field read from the location.
+func NewFieldError(err error, location Location, field string) MarshalerError {
+	return MarshalerError{Err: err, Field: field, Location: location}
+}
+
+// PopulateQueryParameters populates the message with the query parameters
+// one by one, so the malformed parameter is reported in MarshalerError.
+// The error passes httpruntime.TransformUnmarshalerError.
+func PopulateQueryParameters(msg proto.Message, values url.Values, filter *utilities.DoubleArray) error {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		err := runtime.PopulateQueryParameters(msg, url.Values{k: values[k]}, filter)
+		if err != nil {
+			err = errors.Wrapf(err, "couldn't populate query parameter %v", k)
+			return NewFieldError(httpruntime.TransformUnmarshalerError(err), LocationQuery, k)
+		}
+	}
+	return nil
+}
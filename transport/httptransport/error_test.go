@@ -0,0 +1,64 @@
+package httptransport
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/utilities"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestPopulateQueryParameters(t *testing.T) {
+	msg := &descriptorpb.FieldDescriptorProto{}
+	values := url.Values{"name": {"id"}, "number": {"abc"}}
+	err := PopulateQueryParameters(msg, values, utilities.NewDoubleArray(nil))
+	if err == nil {
+		t.Fatal("PopulateQueryParameters() succeeded for malformed number")
+	}
+	if msg.GetName() != "id" {
+		t.Errorf("name = %q, want id", msg.GetName())
+	}
+
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument || runtime.HTTPStatusFromCode(st.Code()) != http.StatusBadRequest {
+		t.Errorf("code = %v, want InvalidArgument", st.Code())
+	}
+	details := st.Details()
+	if len(details) != 1 {
+		t.Fatalf("details = %v, want BadRequest", details)
+	}
+	br, ok := details[0].(*errdetails.BadRequest)
+	if !ok || len(br.FieldViolations) != 1 || br.FieldViolations[0].Field != "number" {
+		t.Errorf("details = %v, want violation of number", details)
+	}
+}
+
+func TestMarshalerError_GRPCStatus(t *testing.T) {
+	err := NewFieldError(status.Error(codes.OutOfRange, "too big"), LocationPath, "id")
+	st := status.Convert(err)
+	if st.Code() != codes.OutOfRange || st.Message() != "too big" {
+		t.Errorf("status = %v, want the wrapped one", st)
+	}
+	details := st.Details()
+	if len(details) != 1 {
+		t.Fatalf("details = %v, want BadRequest", details)
+	}
+	if br, ok := details[0].(*errdetails.BadRequest); !ok || len(br.FieldViolations) != 1 || br.FieldViolations[0].Field != "id" {
+		t.Errorf("details = %v, want violation of id", details)
+	}
+
+	// the cause's violations are kept as is
+	err = NewFieldError(UnknownFieldsError{Location: LocationBody, Names: []string{"a", "b"}}, LocationBody, "*")
+	details = status.Convert(err).Details()
+	if len(details) != 1 {
+		t.Fatalf("details = %v, want BadRequest", details)
+	}
+	if br, ok := details[0].(*errdetails.BadRequest); !ok || len(br.FieldViolations) != 2 {
+		t.Errorf("details = %v, want violations of a and b", details)
+	}
+}
@@ -1,9 +1,13 @@
 package httptransport
 
 import (
+	"context"
+	"net/http"
+
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	"google.golang.org/grpc"
 
+	"github.com/ra9form/yuki/transport/httpruntime"
 	"github.com/ra9form/yuki/transport/swagger"
 )
 
@@ -11,6 +15,21 @@ import (
 type DescOptions struct {
 	UnaryInterceptor   grpc.UnaryServerInterceptor
 	SwaggerDefaultOpts []swagger.Option
+	// ErrorWriter outputs the errors, httpruntime.SetError is used if nil.
+	ErrorWriter httpruntime.ErrorWriter
+	// Marshalers are looked up in the registry,
+	// httpruntime.DefaultRegistry is used if nil.
+	Marshalers *httpruntime.MarshalerRegistry
+	// JSONOptions configure the JSON marshaler of the registry if set.
+	JSONOptions *httpruntime.JSONOptions
+	// UnknownFields is the policy for the unknown fields of the requests.
+	UnknownFields UnknownFieldPolicy
+	// UnknownFieldsLogger reports the unknown fields for UnknownFieldsLog.
+	// The server sets it up to write to its logger unless it is set.
+	UnknownFieldsLogger UnknownFieldsLogger
+
+	// registry is the registry configured by JSONOptions.
+	registry *httpruntime.MarshalerRegistry
 }
 
 // OptionUnaryInterceptor sets up the gRPC unary interceptor.
@@ -39,3 +58,103 @@ type OptionSwaggerOpts struct {
 func (o OptionSwaggerOpts) Apply(oo *DescOptions) {
 	oo.SwaggerDefaultOpts = append(oo.SwaggerDefaultOpts, o.Options...)
 }
+
+// OptionErrorWriter sets up the output of the errors.
+type OptionErrorWriter struct {
+	Writer httpruntime.ErrorWriter
+}
+
+// Apply implements transport.DescOption.
+func (o OptionErrorWriter) Apply(oo *DescOptions) {
+	oo.ErrorWriter = o.Writer
+}
+
+// SetError outputs the error by the ErrorWriter,
+// httpruntime.SetError is used if it isn't set.
+func (o *DescOptions) SetError(ctx context.Context, r *http.Request, w http.ResponseWriter, err error) {
+	if o.ErrorWriter != nil {
+		o.ErrorWriter(ctx, r, w, err)
+		return
+	}
+	httpruntime.SetError(ctx, r, w, err)
+}
+
+// OptionMarshalers sets up the marshaler registry.
+type OptionMarshalers struct {
+	Registry *httpruntime.MarshalerRegistry
+}
+
+// Apply implements transport.DescOption.
+func (o OptionMarshalers) Apply(oo *DescOptions) {
+	oo.Marshalers = o.Registry
+	oo.updateRegistry()
+}
+
+// OptionDefaultMarshalers sets up the marshaler registry unless
+// it is set already, e.g. by OptionMarshalers.
+// It is used for the registry set up for the whole server.
+type OptionDefaultMarshalers struct {
+	Registry *httpruntime.MarshalerRegistry
+}
+
+// Apply implements transport.DescOption.
+func (o OptionDefaultMarshalers) Apply(oo *DescOptions) {
+	if oo.Marshalers == nil {
+		oo.Marshalers = o.Registry
+		oo.updateRegistry()
+	}
+}
+
+// OptionJSON sets up the options of the JSON marshaler.
+type OptionJSON struct {
+	Options httpruntime.JSONOptions
+}
+
+// Apply implements transport.DescOption.
+func (o OptionJSON) Apply(oo *DescOptions) {
+	opts := o.Options
+	oo.JSONOptions = &opts
+	oo.updateRegistry()
+}
+
+// OptionUnknownFields sets up the policy for the unknown fields.
+type OptionUnknownFields struct {
+	Policy UnknownFieldPolicy
+}
+
+// Apply implements transport.DescOption.
+func (o OptionUnknownFields) Apply(oo *DescOptions) {
+	oo.UnknownFields = o.Policy
+}
+
+// OptionUnknownFieldsLogger sets up the logger of the unknown fields
+// unless it is set already.
+// It is used for the logger set up for the whole server.
+type OptionUnknownFieldsLogger struct {
+	Logger UnknownFieldsLogger
+}
+
+// Apply implements transport.DescOption.
+func (o OptionUnknownFieldsLogger) Apply(oo *DescOptions) {
+	if oo.UnknownFieldsLogger == nil {
+		oo.UnknownFieldsLogger = o.Logger
+	}
+}
+
+// MarshalerRegistry returns the registry to look the marshalers up in.
+func (o *DescOptions) MarshalerRegistry() *httpruntime.MarshalerRegistry {
+	if o.registry != nil {
+		return o.registry
+	}
+	if o.Marshalers != nil {
+		return o.Marshalers
+	}
+	return httpruntime.DefaultRegistry
+}
+
+func (o *DescOptions) updateRegistry() {
+	o.registry = nil
+	if o.JSONOptions != nil {
+		o.registry = o.MarshalerRegistry().WithJSONOptions(*o.JSONOptions)
+	}
+}
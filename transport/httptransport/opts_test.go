@@ -0,0 +1,43 @@
+package httptransport
+
+import (
+	"testing"
+
+	"github.com/ra9form/yuki/transport/httpruntime"
+)
+
+func TestDescOptions_MarshalerRegistry(t *testing.T) {
+	var o DescOptions
+	if o.MarshalerRegistry() != httpruntime.DefaultRegistry {
+		t.Error("registry is not the default one")
+	}
+
+	own, server := httpruntime.NewMarshalerRegistry(), httpruntime.NewMarshalerRegistry()
+	OptionMarshalers{Registry: own}.Apply(&o)
+	OptionDefaultMarshalers{Registry: server}.Apply(&o)
+	if o.MarshalerRegistry() != own {
+		t.Error("server's registry overrides the desc's one")
+	}
+
+	o = DescOptions{}
+	OptionDefaultMarshalers{Registry: server}.Apply(&o)
+	if o.MarshalerRegistry() != server {
+		t.Error("server's registry is not used")
+	}
+}
+
+func TestOptionJSON(t *testing.T) {
+	var o DescOptions
+	own := httpruntime.NewMarshalerRegistry()
+	OptionJSON{Options: httpruntime.JSONOptions{EmitUnpopulated: true}}.Apply(&o)
+	OptionMarshalers{Registry: own}.Apply(&o)
+
+	reg := o.MarshalerRegistry()
+	if reg == own || reg == httpruntime.DefaultRegistry {
+		t.Fatal("JSON options are not applied")
+	}
+	own.Override("text/x-test", httpruntime.MarshalerPbText{})
+	if _, ok := reg.Lookup("text/x-test", nil); !ok {
+		t.Error("desc's registry is not used")
+	}
+}
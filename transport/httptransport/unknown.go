@@ -0,0 +1,292 @@
+package httptransport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/utilities"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/ra9form/yuki/transport/httpruntime"
+)
+
+// UnknownFieldPolicy defines the handling of the unknown fields of
+// the JSON bodies and of the unknown query parameters.
+type UnknownFieldPolicy int
+
+const (
+	// UnknownFieldsDefault leaves the unknown fields to the marshalers:
+	// the default JSON marshaler rejects them unless
+	// JSONOptions.DiscardUnknown is set, the query parameters are ignored.
+	UnknownFieldsDefault UnknownFieldPolicy = iota
+	// UnknownFieldsReject fails the requests with InvalidArgument
+	// listing the unknown fields, see UnknownFieldsError.
+	UnknownFieldsReject
+	// UnknownFieldsIgnore ignores the unknown fields.
+	UnknownFieldsIgnore
+	// UnknownFieldsLog ignores the unknown fields, reporting them
+	// to the UnknownFieldsLogger.
+	UnknownFieldsLog
+)
+
+// UnknownFieldsLogger reports the unknown fields of the request.
+type UnknownFieldsLogger func(ctx context.Context, location Location, names []string)
+
+// UnknownFieldsError lists the unknown fields of the request.
+type UnknownFieldsError struct {
+	Location Location
+	Names    []string
+}
+
+func (e UnknownFieldsError) Error() string {
+	return fmt.Sprintf("unknown %vs: %v", e.noun(), strings.Join(e.Names, ", "))
+}
+
+// noun names the fields of the location.
+func (e UnknownFieldsError) noun() string {
+	if e.Location == LocationQuery {
+		return "query parameter"
+	}
+	return fmt.Sprintf("%v field", e.Location)
+}
+
+// GRPCStatus reports the error as InvalidArgument with the BadRequest
+// detail listing the fields.
+func (e UnknownFieldsError) GRPCStatus() *status.Status {
+	st := status.New(codes.InvalidArgument, e.Error())
+	br := &errdetails.BadRequest{}
+	for _, name := range e.Names {
+		br.FieldViolations = append(br.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       name,
+			Description: "unknown " + e.noun(),
+		})
+	}
+	withDetails, err := st.WithDetails(br)
+	if err != nil {
+		return st
+	}
+	return withDetails
+}
+
+// UnknownFieldsMarshaler returns the inbound marshaler applying
+// the UnknownFields policy to the JSON bodies.
+// The other marshalers are returned as is.
+func (o *DescOptions) UnknownFieldsMarshaler(ctx context.Context, m httpruntime.Marshaler) httpruntime.Marshaler {
+	if o.UnknownFields == UnknownFieldsDefault || m == nil || m.ContentType() != "application/json" {
+		return m
+	}
+	if o.UnknownFields != UnknownFieldsReject {
+		if pbjson, ok := m.(httpruntime.MarshalerPbJSON); ok {
+			m = pbjson.DiscardingUnknown()
+		}
+	}
+	return unknownFieldsMarshaler{Marshaler: m, ctx: ctx, opts: o}
+}
+
+// unknownFieldsMarshaler checks the JSON bodies for the unknown fields
+// before unmarshaling them.
+type unknownFieldsMarshaler struct {
+	httpruntime.Marshaler
+	ctx  context.Context
+	opts *DescOptions
+}
+
+func (m unknownFieldsMarshaler) Unmarshal(r io.Reader, dst interface{}) error {
+	msg, err := httpruntime.AsProtoMessage(dst)
+	if err != nil {
+		// scalar or repeated body fields don't have unknown fields
+		return m.Marshaler.Unmarshal(r, dst)
+	}
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	names := unknownJSONFields(msg.ProtoReflect().Descriptor(), buf, "")
+	if err := m.opts.reportUnknown(m.ctx, LocationBody, names); err != nil {
+		return err
+	}
+	return m.Marshaler.Unmarshal(bytes.NewReader(buf), dst)
+}
+
+// CheckUnknownQuery wraps the unmarshaler applying the UnknownFields
+// policy to the query parameters.
+// The parameters matching the filter (bound by the path or the body)
+// are not checked.
+func (o *DescOptions) CheckUnknownQuery(r *http.Request, unm func(interface{}) error, filter *utilities.DoubleArray) func(interface{}) error {
+	if o.UnknownFields != UnknownFieldsReject && o.UnknownFields != UnknownFieldsLog {
+		return unm
+	}
+	return func(dst interface{}) error {
+		if err := unm(dst); err != nil {
+			return err
+		}
+		msg, err := httpruntime.AsProtoMessage(dst)
+		if err != nil {
+			return nil
+		}
+		names := unknownQueryParams(msg.ProtoReflect().Descriptor(), r.URL.Query(), filter)
+		if err := o.reportUnknown(r.Context(), LocationQuery, names); err != nil {
+			return NewFieldError(err, LocationQuery, "")
+		}
+		return nil
+	}
+}
+
+// reportUnknown applies the policy to the unknown fields.
+func (o *DescOptions) reportUnknown(ctx context.Context, location Location, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	switch o.UnknownFields {
+	case UnknownFieldsReject:
+		return UnknownFieldsError{Location: location, Names: names}
+	case UnknownFieldsLog:
+		if o.UnknownFieldsLogger != nil {
+			o.UnknownFieldsLogger(ctx, location, names)
+		}
+	}
+	return nil
+}
+
+// specialJSONTypes are the well-known types having special JSON forms.
+var specialJSONTypes = map[protoreflect.FullName]bool{
+	"google.protobuf.Any":         true,
+	"google.protobuf.Duration":    true,
+	"google.protobuf.FieldMask":   true,
+	"google.protobuf.ListValue":   true,
+	"google.protobuf.Struct":      true,
+	"google.protobuf.Timestamp":   true,
+	"google.protobuf.Value":       true,
+	"google.protobuf.BoolValue":   true,
+	"google.protobuf.BytesValue":  true,
+	"google.protobuf.DoubleValue": true,
+	"google.protobuf.FloatValue":  true,
+	"google.protobuf.Int32Value":  true,
+	"google.protobuf.Int64Value":  true,
+	"google.protobuf.StringValue": true,
+	"google.protobuf.UInt32Value": true,
+	"google.protobuf.UInt64Value": true,
+}
+
+// unknownJSONFields returns the paths of the JSON object's fields
+// missing in the message.
+func unknownJSONFields(md protoreflect.MessageDescriptor, data []byte, prefix string) []string {
+	if specialJSONTypes[md.FullName()] {
+		return nil
+	}
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(data, &obj) != nil {
+		// not an object, the marshaler reports it
+		return nil
+	}
+
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var ret []string
+	for _, k := range keys {
+		if strings.HasPrefix(k, "[") {
+			// extensions are resolved by the marshaler
+			continue
+		}
+		fd := findField(md.Fields(), k)
+		if fd == nil {
+			ret = append(ret, prefix+k)
+			continue
+		}
+
+		path := prefix + k
+		switch {
+		case fd.IsMap():
+			if fd.MapValue().Message() == nil {
+				continue
+			}
+			var m map[string]json.RawMessage
+			json.Unmarshal(obj[k], &m)
+			mkeys := make([]string, 0, len(m))
+			for mk := range m {
+				mkeys = append(mkeys, mk)
+			}
+			sort.Strings(mkeys)
+			for _, mk := range mkeys {
+				ret = append(ret, unknownJSONFields(fd.MapValue().Message(), m[mk], fmt.Sprintf("%v[%v].", path, mk))...)
+			}
+		case fd.Message() == nil:
+		case fd.IsList():
+			var l []json.RawMessage
+			json.Unmarshal(obj[k], &l)
+			for i, v := range l {
+				ret = append(ret, unknownJSONFields(fd.Message(), v, fmt.Sprintf("%v[%v].", path, i))...)
+			}
+		default:
+			ret = append(ret, unknownJSONFields(fd.Message(), obj[k], path+".")...)
+		}
+	}
+	return ret
+}
+
+// queryMapKey matches the map entries of the query, e.g. "labels[key]".
+var queryMapKey = regexp.MustCompile(`^(.*)\[(.*)\]$`)
+
+// unknownQueryParams returns the query parameters that don't
+// resolve to the message's fields.
+func unknownQueryParams(md protoreflect.MessageDescriptor, values map[string][]string, filter *utilities.DoubleArray) []string {
+	var ret []string
+	for key := range values {
+		name := key
+		if m := queryMapKey.FindStringSubmatch(key); len(m) == 3 {
+			name = m[1]
+		}
+		path := strings.Split(name, ".")
+		if filter != nil && filter.HasCommonPrefix(path) {
+			continue
+		}
+		if !hasFieldPath(md, path) {
+			ret = append(ret, key)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// hasFieldPath reports if the dot-separated path resolves to a field.
+func hasFieldPath(md protoreflect.MessageDescriptor, path []string) bool {
+	for i, name := range path {
+		fd := findField(md.Fields(), name)
+		if fd == nil {
+			return false
+		}
+		if i == len(path)-1 {
+			return true
+		}
+		if fd.Message() == nil || fd.IsList() || fd.IsMap() {
+			return false
+		}
+		md = fd.Message()
+	}
+	return false
+}
+
+// findField finds the field by its name or JSON name, as protojson
+// and the query parser do.
+func findField(fields protoreflect.FieldDescriptors, name string) protoreflect.FieldDescriptor {
+	if fd := fields.ByName(protoreflect.Name(name)); fd != nil {
+		return fd
+	}
+	return fields.ByJSONName(name)
+}
@@ -0,0 +1,98 @@
+package httptransport
+
+import (
+	"context"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/utilities"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/typepb"
+
+	"github.com/ra9form/yuki/transport/httpruntime"
+)
+
+const unknownBody = `{"name":"id","typo":1,"options":[{"name":"a","bogus":2}]}`
+
+func TestUnknownFieldsMarshaler(t *testing.T) {
+	var logged []string
+	tests := []struct {
+		policy  UnknownFieldPolicy
+		wantErr bool
+		logged  []string
+	}{
+		{UnknownFieldsDefault, true, nil},
+		{UnknownFieldsReject, true, nil},
+		{UnknownFieldsIgnore, false, nil},
+		{UnknownFieldsLog, false, []string{"options[0].bogus", "typo"}},
+	}
+	for _, tt := range tests {
+		logged = nil
+		o := &DescOptions{
+			UnknownFields: tt.policy,
+			UnknownFieldsLogger: func(_ context.Context, _ Location, names []string) {
+				logged = names
+			},
+		}
+		m := o.UnknownFieldsMarshaler(context.Background(), httpruntime.DefaultMarshaler(nil))
+
+		var msg *typepb.Field
+		err := m.Unmarshal(strings.NewReader(unknownBody), &msg)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("policy %v: Unmarshal() error = %v, want error %v", tt.policy, err, tt.wantErr)
+		}
+		if err == nil && msg.GetName() != "id" {
+			t.Errorf("policy %v: name = %q, want id", tt.policy, msg.GetName())
+		}
+		if !reflect.DeepEqual(logged, tt.logged) {
+			t.Errorf("policy %v: logged %v, want %v", tt.policy, logged, tt.logged)
+		}
+	}
+
+	// nothing is logged without the logger
+	o := &DescOptions{UnknownFields: UnknownFieldsLog}
+	m := o.UnknownFieldsMarshaler(context.Background(), httpruntime.DefaultMarshaler(nil))
+	if err := m.Unmarshal(strings.NewReader(unknownBody), &typepb.Field{}); err != nil {
+		t.Errorf("without logger: Unmarshal() error = %v", err)
+	}
+}
+
+func TestUnknownFieldsError(t *testing.T) {
+	o := &DescOptions{UnknownFields: UnknownFieldsReject}
+	m := o.UnknownFieldsMarshaler(context.Background(), httpruntime.DefaultMarshaler(nil))
+	err := m.Unmarshal(strings.NewReader(unknownBody), &typepb.Field{})
+
+	st := status.Convert(NewFieldError(err, LocationBody, ""))
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("code = %v, want InvalidArgument", st.Code())
+	}
+	var fields []string
+	for _, d := range st.Details() {
+		for _, v := range d.(*errdetails.BadRequest).FieldViolations {
+			fields = append(fields, v.Field)
+		}
+	}
+	if want := []string{"options[0].bogus", "typo"}; !reflect.DeepEqual(fields, want) {
+		t.Errorf("violations = %v, want %v", fields, want)
+	}
+}
+
+func TestCheckUnknownQuery(t *testing.T) {
+	o := &DescOptions{UnknownFields: UnknownFieldsReject}
+	r := httptest.NewRequest("GET", "/?name=id&jsonName=j&nmae=x&source_context.file_name=f", nil)
+	filter := utilities.NewDoubleArray(nil)
+	unm := func(dst interface{}) error {
+		return PopulateQueryParameters(dst.(*typepb.Field), r.URL.Query(), filter)
+	}
+
+	err := o.CheckUnknownQuery(r, unm, filter)(&typepb.Field{})
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument || !strings.Contains(st.Message(), "nmae") ||
+		strings.Contains(st.Message(), "name,") || strings.Contains(st.Message(), "jsonName") {
+		t.Errorf("status = %v, want InvalidArgument for nmae only", st)
+	}
+}
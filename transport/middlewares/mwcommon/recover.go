@@ -0,0 +1,16 @@
+package mwcommon
+
+import (
+	"github.com/ra9form/yuki/server/middlewares/mwcommon"
+)
+
+// PanicHook is called with the recovered panic, see mwcommon.PanicHook.
+type PanicHook = mwcommon.PanicHook
+
+// RecoverOption configures the panic handlers.
+type RecoverOption = mwcommon.RecoverOption
+
+// WithPanicHook adds the hook called on every recovered panic.
+func WithPanicHook(hook PanicHook) RecoverOption {
+	return mwcommon.WithPanicHook(hook)
+}
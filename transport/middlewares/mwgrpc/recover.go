@@ -3,15 +3,18 @@ package mwgrpc
 import (
 	"google.golang.org/grpc"
 
+	"github.com/ra9form/yuki/server/middlewares/mwcommon"
 	"github.com/ra9form/yuki/server/middlewares/mwgrpc"
 )
 
 // UnaryPanicHandler handles panics for UnaryHandlers.
-func UnaryPanicHandler(logger interface{}) grpc.UnaryServerInterceptor {
-	return mwgrpc.UnaryPanicHandler(logger)
+// The options add panic hooks, see mwcommon.WithPanicHook.
+func UnaryPanicHandler(logger interface{}, opts ...mwcommon.RecoverOption) grpc.UnaryServerInterceptor {
+	return mwgrpc.UnaryPanicHandler(logger, opts...)
 }
 
 // StreamPanicHandler handles panics for StreamHandlers.
-func StreamPanicHandler(logger interface{}) grpc.StreamServerInterceptor {
-	return mwgrpc.StreamPanicHandler(logger)
+// The options add panic hooks, see mwcommon.WithPanicHook.
+func StreamPanicHandler(logger interface{}, opts ...mwcommon.RecoverOption) grpc.StreamServerInterceptor {
+	return mwgrpc.StreamPanicHandler(logger, opts...)
 }
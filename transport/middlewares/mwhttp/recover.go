@@ -1,10 +1,19 @@
 package mwhttp
 
 import (
+	"github.com/ra9form/yuki/server/middlewares/mwcommon"
 	"github.com/ra9form/yuki/server/middlewares/mwhttp"
+	"github.com/ra9form/yuki/transport/httpruntime"
 )
 
 // Recover recovers HTTP server from handlers' panics.
-func Recover(logger interface{}) Middleware {
-	return mwhttp.Recover(logger)
+// The options add panic hooks, see mwcommon.WithPanicHook, and set up
+// the error output, see WithErrorWriter.
+func Recover(logger interface{}, opts ...mwcommon.RecoverOption) Middleware {
+	return mwhttp.Recover(logger, opts...)
+}
+
+// WithErrorWriter makes Recover write the errors by w.
+func WithErrorWriter(w httpruntime.ErrorWriter) mwcommon.RecoverOption {
+	return mwhttp.WithErrorWriter(w)
 }
@@ -3,6 +3,7 @@ package transport
 import (
 	"google.golang.org/grpc"
 
+	"github.com/ra9form/yuki/transport/httpruntime"
 	"github.com/ra9form/yuki/transport/httptransport"
 	"github.com/ra9form/yuki/transport/swagger"
 )
@@ -21,3 +22,31 @@ func WithUnaryInterceptor(i grpc.UnaryServerInterceptor) DescOption {
 func WithSwaggerOptions(o ...swagger.Option) DescOption {
 	return httptransport.OptionSwaggerOpts{Options: o}
 }
+
+// WithErrorWriter sets up the output of the errors of the HTTP handlers,
+// e.g. httpruntime.StatusErrorWriter.
+// The global httpruntime.SetError is used by default.
+func WithErrorWriter(w httpruntime.ErrorWriter) DescOption {
+	return httptransport.OptionErrorWriter{Writer: w}
+}
+
+// WithMarshalers sets up the registry the HTTP handlers look
+// the marshalers up in.
+// httpruntime.DefaultRegistry is used by default.
+func WithMarshalers(r *httpruntime.MarshalerRegistry) DescOption {
+	return httptransport.OptionMarshalers{Registry: r}
+}
+
+// WithJSONOptions configures the JSON marshaler of the HTTP handlers.
+// The options can be overridden per request by the media type parameters,
+// see httpruntime.JSONOptions.WithParams.
+func WithJSONOptions(o httpruntime.JSONOptions) DescOption {
+	return httptransport.OptionJSON{Options: o}
+}
+
+// WithUnknownFields sets up the policy for the unknown fields of the JSON
+// bodies and for the unknown query parameters of the HTTP handlers.
+// The server logs them with its logger for UnknownFieldsLog.
+func WithUnknownFields(p httptransport.UnknownFieldPolicy) DescOption {
+	return httptransport.OptionUnknownFields{Policy: p}
+}
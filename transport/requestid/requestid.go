@@ -0,0 +1,59 @@
+// Package requestid carries the request ID through the calls.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// Header is the HTTP header holding the request ID.
+const Header = "X-Request-Id"
+
+// MDKey is the gRPC metadata key holding the request ID.
+const MDKey = "x-request-id"
+
+type ctxKey struct{}
+
+// NewContext returns a context carrying the request ID.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the request ID carried by the context.
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(ctxKey{}).(string)
+	return id, ok && id != ""
+}
+
+// New generates a random request ID.
+func New() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// MaxLen is the maximal length of a valid request ID.
+const MaxLen = 128
+
+// Valid returns true if the request ID received from a client can be used:
+// it is not longer than MaxLen and consists of ASCII letters, digits
+// and "-_.:+/=" only.
+// The invalid IDs are to be replaced by New, since they end up in
+// the logs and the headers of the outgoing calls.
+func Valid(id string) bool {
+	if id == "" || len(id) > MaxLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case strings.IndexByte("-_.:+/=", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
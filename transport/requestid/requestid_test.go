@@ -0,0 +1,28 @@
+package requestid
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{New(), true},
+		{"6ba7b810-9dad-11d1-80b4-00c04fd430c8", true},
+		{"req_1.2:3+4/5=", true},
+		{strings.Repeat("a", MaxLen), true},
+		{strings.Repeat("a", MaxLen+1), false},
+		{"", false},
+		{"a b", false},
+		{"a\nlevel=error", false},
+		{"запрос", false},
+	}
+	for _, tt := range tests {
+		if got := Valid(tt.id); got != tt.want {
+			t.Errorf("Valid(%q) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
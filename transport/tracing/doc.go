@@ -0,0 +1,6 @@
+// Package tracing provides minimal distributed tracing compatible with
+// W3C Trace Context propagation (traceparent and tracestate headers).
+//
+// Spans are created by the Tracer and passed to its Exporter once ended.
+// Use server/middlewares/mwtracing to trace the calls served by the server.
+package tracing
@@ -0,0 +1,70 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// Propagation header names, lowercase as required by gRPC metadata.
+const (
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+)
+
+// Extract returns the remote span context from the header values.
+func Extract(get func(key string) string) (SpanContext, bool) {
+	sc, err := ParseTraceparent(get(TraceparentHeader))
+	if err != nil {
+		return SpanContext{}, false
+	}
+	sc.TraceState = get(TracestateHeader)
+	return sc, true
+}
+
+// Inject sets the headers propagating the span context.
+func Inject(sc SpanContext, set func(key, value string)) {
+	if !sc.IsValid() {
+		return
+	}
+	set(TraceparentHeader, sc.Traceparent())
+	if sc.TraceState != "" {
+		set(TracestateHeader, sc.TraceState)
+	}
+}
+
+// ExtractHTTP returns the remote span context from the HTTP headers.
+func ExtractHTTP(h http.Header) (SpanContext, bool) {
+	return Extract(h.Get)
+}
+
+// InjectHTTP sets the HTTP headers propagating the context's span.
+func InjectHTTP(ctx context.Context, h http.Header) {
+	if s := SpanFromContext(ctx); s != nil {
+		Inject(s.SpanContext(), h.Set)
+	}
+}
+
+// ExtractMD returns the remote span context from gRPC metadata.
+func ExtractMD(md metadata.MD) (SpanContext, bool) {
+	return Extract(func(key string) string {
+		if vv := md.Get(key); len(vv) > 0 {
+			return vv[0]
+		}
+		return ""
+	})
+}
+
+// InjectOutgoingMD returns the context with outgoing gRPC metadata
+// propagating the context's span.
+func InjectOutgoingMD(ctx context.Context) context.Context {
+	s := SpanFromContext(ctx)
+	if s == nil {
+		return ctx
+	}
+	md, _ := metadata.FromOutgoingContext(ctx)
+	md = md.Copy()
+	Inject(s.SpanContext(), func(k, v string) { md.Set(k, v) })
+	return metadata.NewOutgoingContext(ctx, md)
+}
@@ -0,0 +1,108 @@
+package tracing
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// IsValid returns false for the all-zero ID.
+func (id TraceID) IsValid() bool { return id != TraceID{} }
+
+func (id TraceID) String() string { return hex.EncodeToString(id[:]) }
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+// IsValid returns false for the all-zero ID.
+func (id SpanID) IsValid() bool { return id != SpanID{} }
+
+func (id SpanID) String() string { return hex.EncodeToString(id[:]) }
+
+// FlagSampled is the trace flag marking the sampled traces.
+const FlagSampled = byte(0x01)
+
+// SpanContext is the part of a span propagated across the processes.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Flags   byte
+	// TraceState is the vendor-specific tracestate header, passed as is.
+	TraceState string
+}
+
+// IsValid returns true if both trace and span IDs are set.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// IsSampled returns true if the trace is recorded.
+func (sc SpanContext) IsSampled() bool {
+	return sc.Flags&FlagSampled != 0
+}
+
+// Traceparent formats the span context as the traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+// ParseTraceparent parses the traceparent header value, e.g.
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 {
+		return sc, errors.Errorf("invalid traceparent %q", s)
+	}
+	version, err := hex.DecodeString(parts[0])
+	switch {
+	case err != nil || len(version) != 1 || version[0] == 0xff:
+		return sc, errors.Errorf("invalid traceparent version %q", parts[0])
+	case version[0] == 0 && len(parts) != 4:
+		// future versions may append fields
+		return sc, errors.Errorf("invalid traceparent %q", s)
+	}
+
+	if err := decodeHex(sc.TraceID[:], parts[1]); err != nil || !sc.TraceID.IsValid() {
+		return sc, errors.Errorf("invalid trace ID %q", parts[1])
+	}
+	if err := decodeHex(sc.SpanID[:], parts[2]); err != nil || !sc.SpanID.IsValid() {
+		return sc, errors.Errorf("invalid span ID %q", parts[2])
+	}
+	var flags [1]byte
+	if err := decodeHex(flags[:], parts[3]); err != nil {
+		return sc, errors.Errorf("invalid trace flags %q", parts[3])
+	}
+	sc.Flags = flags[0]
+	return sc, nil
+}
+
+// decodeHex decodes lowercase hex string s, which must fill dst.
+func decodeHex(dst []byte, s string) error {
+	if len(s) != 2*len(dst) || strings.ToLower(s) != s {
+		return errors.New("invalid length or case")
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
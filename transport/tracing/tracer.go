@@ -0,0 +1,212 @@
+package tracing
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+// SpanKind is the role of the span in the call.
+type SpanKind int
+
+const (
+	// SpanKindInternal is an operation within the process.
+	SpanKindInternal SpanKind = iota
+	// SpanKindServer handles an incoming call.
+	SpanKindServer
+	// SpanKindClient makes an outgoing call.
+	SpanKindClient
+)
+
+// SpanData is the snapshot of an ended span passed to the Exporter.
+type SpanData struct {
+	Name          string
+	Kind          SpanKind
+	SpanContext   SpanContext
+	Parent        SpanContext
+	Start         time.Time
+	End           time.Time
+	Attributes    map[string]string
+	Code          codes.Code
+	StatusMessage string
+}
+
+// Span is an operation within a trace.
+type Span struct {
+	tracer *Tracer
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// SpanContext returns the span's context to propagate.
+func (s *Span) SpanContext() SpanContext {
+	return s.data.SpanContext
+}
+
+// SetAttribute sets the attribute of the span.
+// It is ignored once the span is ended, since the exporter owns the data.
+func (s *Span) SetAttribute(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ended {
+		return
+	}
+	if s.data.Attributes == nil {
+		s.data.Attributes = map[string]string{}
+	}
+	s.data.Attributes[key] = value
+}
+
+// SetStatus sets the result of the operation.
+// It is ignored once the span is ended.
+func (s *Span) SetStatus(code codes.Code, msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ended {
+		return
+	}
+	s.data.Code = code
+	s.data.StatusMessage = msg
+}
+
+// End finishes the span and exports it if the trace is sampled.
+// Subsequent calls are ignored.
+func (s *Span) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+
+	if data.SpanContext.IsSampled() && s.tracer.exporter != nil {
+		s.tracer.exporter.ExportSpan(data)
+	}
+}
+
+// Exporter receives the ended spans.
+// It is called synchronously, so it should not block.
+type Exporter interface {
+	ExportSpan(SpanData)
+}
+
+// Tracer creates the spans.
+type Tracer struct {
+	exporter Exporter
+	sample   func(TraceID) bool
+}
+
+// TracerOption configures the Tracer.
+type TracerOption func(*Tracer)
+
+// WithSampler sets the func deciding if a new trace is recorded.
+// The decision of the remote parent is used for the propagated traces.
+// Every trace is recorded by default.
+func WithSampler(sample func(TraceID) bool) TracerOption {
+	return func(t *Tracer) {
+		t.sample = sample
+	}
+}
+
+// NewTracer creates a Tracer passing the spans to the exporter.
+func NewTracer(exporter Exporter, opts ...TracerOption) *Tracer {
+	t := &Tracer{
+		exporter: exporter,
+		sample:   func(TraceID) bool { return true },
+	}
+	for _, o := range opts {
+		o(t)
+	}
+	return t
+}
+
+// Start starts a new span.
+// The span is a child of the span in ctx or, if there is none, of the
+// remote parent; a new trace is started if neither is valid.
+// The returned context carries the new span.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind, remote SpanContext) (context.Context, *Span) {
+	parent := remote
+	if s := SpanFromContext(ctx); s != nil {
+		parent = s.SpanContext()
+	}
+
+	sc := SpanContext{SpanID: newSpanID()}
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Flags = parent.Flags
+		sc.TraceState = parent.TraceState
+	} else {
+		parent = SpanContext{}
+		sc.TraceID = newTraceID()
+		if t.sample(sc.TraceID) {
+			sc.Flags |= FlagSampled
+		}
+	}
+
+	span := &Span{
+		tracer: t,
+		data: SpanData{
+			Name:        name,
+			Kind:        kind,
+			SpanContext: sc,
+			Parent:      parent,
+			Start:       time.Now(),
+		},
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+type spanKey struct{}
+
+// ContextWithSpan returns a context carrying the span.
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, s)
+}
+
+// SpanFromContext returns the current span, nil if there is none.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// InMemoryExporter keeps the exported spans in memory; it is meant
+// for the tests.
+type InMemoryExporter struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+// NewInMemoryExporter creates an empty InMemoryExporter.
+func NewInMemoryExporter() *InMemoryExporter {
+	return &InMemoryExporter{}
+}
+
+// ExportSpan implements Exporter.
+func (e *InMemoryExporter) ExportSpan(s SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, s)
+}
+
+// Spans returns the exported spans in the order they ended.
+func (e *InMemoryExporter) Spans() []SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]SpanData(nil), e.spans...)
+}
+
+// Reset forgets the exported spans.
+func (e *InMemoryExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
@@ -0,0 +1,30 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+)
+
+func TestSpan_End(t *testing.T) {
+	exp := NewInMemoryExporter()
+	_, span := NewTracer(exp).Start(context.Background(), "call", SpanKindServer, SpanContext{})
+	span.SetAttribute("key", "before")
+	span.End()
+
+	// the exported data must not change after End
+	span.SetAttribute("key", "after")
+	span.SetAttribute("other", "after")
+	span.SetStatus(codes.Internal, "after")
+	span.End()
+
+	spans := exp.Spans()
+	if len(spans) != 1 {
+		t.Fatalf("exported %v spans, want 1", len(spans))
+	}
+	got := spans[0]
+	if len(got.Attributes) != 1 || got.Attributes["key"] != "before" || got.Code != codes.OK {
+		t.Errorf("exported span changed after End: %+v", got)
+	}
+}